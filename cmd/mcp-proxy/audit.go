@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/voicetreelab/lazy-mcp/internal/audit"
+)
+
+// runAudit implements "mcp-proxy audit": it prints the audit records matching the flags
+func runAudit(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	conf := newConfigFlags(fs, "path to config file or a http(s) url, used to find the audit log")
+	file := fs.String("file", "", "path to the audit log (overrides config)")
+	since := fs.String("since", "", "only calls since a duration ago (e.g. '1h') or an RFC 3339 time")
+	caller := fs.String("caller", "", "only calls by this caller identity")
+	server := fs.String("server", "", "only calls to this server")
+	tool := fs.String("tool", "", "only tool paths matching this glob, e.g. 'github.*'")
+	failed := fs.Bool("errors", false, "only calls that failed")
+	limit := fs.Int("limit", 50, "print at most the last N matching calls (0 for all)")
+	asJSON := fs.Bool("json", false, "print matching records as JSON lines")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	logPath := *file
+	if logPath == "" {
+		cfg, err := conf.load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if cfg.McpProxy.Options == nil || cfg.McpProxy.Options.Audit == nil || cfg.McpProxy.Options.Audit.Path == "" {
+			return fmt.Errorf("no audit log configured in %s, pass -file", *conf.path)
+		}
+		logPath = cfg.McpProxy.Options.Audit.Path
+	}
+
+	filter := audit.Filter{Caller: *caller, Server: *server, Tool: *tool, Failed: *failed}
+	if *since != "" {
+		sinceTime, err := parseSince(*since, time.Now())
+		if err != nil {
+			return err
+		}
+		filter.Since = sinceTime
+	}
+
+	records, err := audit.Query(logPath, filter, *limit)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(out)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tCALLER\tTOOL\tSERVER\tDURATION\tRESULT")
+	for _, record := range records {
+		status := "ok"
+		if record.ErrorClass != "" {
+			status = record.ErrorClass
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			record.Time.Local().Format(time.DateTime), record.Caller, record.ToolPath, record.Server,
+			time.Duration(record.DurationMs)*time.Millisecond, status)
+	}
+	return tw.Flush()
+}
+
+// parseSince accepts a duration before now or an absolute RFC 3339 time
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -since %q: use a duration like '1h' or an RFC 3339 time", value)
+	}
+	return t, nil
+}
+
+func auditMain(args []string) {
+	if err := runAudit(args, os.Stdout); err != nil {
+		if err == flag.ErrHelp {
+			return
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/voicetreelab/lazy-mcp/internal/config"
 	"github.com/voicetreelab/lazy-mcp/internal/server"
@@ -12,13 +13,14 @@ import (
 var BuildVersion = "dev"
 
 func main() {
-	conf := flag.String("config", "config.json", "path to config file or a http(s) url")
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		auditMain(os.Args[2:])
+		return
+	}
+
+	conf := newConfigFlags(flag.CommandLine, "path to config file or a http(s) url")
 	port := flag.String("port", "", "port to listen on (overrides config), e.g. '8080' or ':8080'")
 	_ = flag.String("hierarchy", "testdata/mcp_hierarchy", "path to hierarchy directory")
-	insecure := flag.Bool("insecure", false, "allow insecure HTTPS connections by skipping TLS certificate verification")
-	expandEnv := flag.Bool("expand-env", true, "expand environment variables in config file")
-	httpHeaders := flag.String("http-headers", "", "optional HTTP headers for config URL, format: 'Key1:Value1;Key2:Value2'")
-	httpTimeout := flag.Int("http-timeout", 10, "HTTP timeout in seconds when fetching config from URL")
 
 	version := flag.Bool("version", false, "print version and exit")
 	help := flag.Bool("help", false, "print help and exit")
@@ -31,7 +33,7 @@ func main() {
 		fmt.Println(BuildVersion)
 		return
 	}
-	cfg, err := config.Load(*conf, *insecure, *expandEnv, *httpHeaders, *httpTimeout)
+	cfg, err := conf.load()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
@@ -45,15 +47,31 @@ func main() {
 		}
 	}
 
-	// Start server based on configured type
-	switch cfg.McpProxy.Type {
-	case config.MCPServerTypeStdio:
-		err = server.StartStdioServer(cfg)
-	default:
-		err = server.StartHTTPServer(cfg)
+	// Start the configured front-ends
+	if err := server.StartServers(cfg); err != nil {
+		log.Fatalf("Failed to start server: %v", err)
 	}
+}
 
-	if err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+// configFlags locate and load the config file; every command that reads the config registers them
+type configFlags struct {
+	path        *string
+	insecure    *bool
+	expandEnv   *bool
+	httpHeaders *string
+	httpTimeout *int
+}
+
+func newConfigFlags(fs *flag.FlagSet, pathUsage string) *configFlags {
+	return &configFlags{
+		path:        fs.String("config", "config.json", pathUsage),
+		insecure:    fs.Bool("insecure", false, "allow insecure HTTPS connections by skipping TLS certificate verification"),
+		expandEnv:   fs.Bool("expand-env", true, "expand environment variables in config file"),
+		httpHeaders: fs.String("http-headers", "", "optional HTTP headers for config URL, format: 'Key1:Value1;Key2:Value2'"),
+		httpTimeout: fs.Int("http-timeout", 10, "HTTP timeout in seconds when fetching config from URL"),
 	}
 }
+
+func (f *configFlags) load() (*config.Config, error) {
+	return config.Load(*f.path, *f.insecure, *f.expandEnv, *f.httpHeaders, *f.httpTimeout)
+}
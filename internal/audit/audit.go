@@ -0,0 +1,243 @@
+// Package audit writes and reads the JSONL audit log of execute_tool calls
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/redact"
+)
+
+const (
+	defaultMaxSizeMB  = 100
+	defaultMaxBackups = 5
+
+	// Redacted replaces the value of redacted arguments
+	Redacted = redact.Placeholder
+)
+
+// defaultRedactArguments applies when the config does not list its own patterns
+var defaultRedactArguments = []string{"*password*", "*secret*", "*token", "*api_key", "*apikey", "authorization", "cookie"}
+
+// Record is one execute_tool call in the audit log
+type Record struct {
+	Time     time.Time `json:"time"`
+	Caller   string    `json:"caller"`
+	Session  string    `json:"session,omitempty"`
+	ToolPath string    `json:"tool_path"`
+	Server   string    `json:"server,omitempty"`
+	MapsTo   string    `json:"maps_to,omitempty"`
+	// ArgsDigest is the SHA-256 of the arguments as JSON, taken after redaction
+	ArgsDigest  string                 `json:"args_digest"`
+	Arguments   map[string]interface{} `json:"arguments,omitempty"`
+	DurationMs  int64                  `json:"duration_ms"`
+	ResultBytes int                    `json:"result_bytes"`
+	// ErrorClass is empty for successful calls, e.g. "timeout" or "access_denied" otherwise
+	ErrorClass string `json:"error_class,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Logger appends records to the audit log and rotates it by size
+type Logger struct {
+	path         string
+	maxBytes     int64
+	maxBackups   int
+	logArguments bool
+	redact       []string
+	redactor     *redact.Redactor
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens the audit log configured in cfg, creating it if needed
+// If redactor is not nil, it also scrubs argument values and error messages.
+func Open(cfg *config.AuditConfig, redactor *redact.Redactor) (*Logger, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("audit: path is required")
+	}
+	l := &Logger{
+		path:         cfg.Path,
+		maxBytes:     int64(cfg.MaxSizeMB) << 20,
+		maxBackups:   cfg.MaxBackups,
+		logArguments: cfg.LogArguments,
+		redact:       cfg.RedactArguments,
+		redactor:     redactor,
+	}
+	if l.maxBytes <= 0 {
+		l.maxBytes = defaultMaxSizeMB << 20
+	}
+	if l.maxBackups <= 0 {
+		l.maxBackups = defaultMaxBackups
+	}
+	if l.redact == nil {
+		l.redact = defaultRedactArguments
+	}
+	for _, pattern := range l.redact {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("audit: invalid redactArguments pattern %q: %w", pattern, err)
+		}
+	}
+	if err := l.openFile(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Logger) openFile() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("audit: %w", err)
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// Log redacts and digests arguments into record, then appends it
+func (l *Logger) Log(record Record, arguments map[string]interface{}) error {
+	redacted := l.redactArguments(arguments)
+	if redacted != nil {
+		redacted = l.redactor.Value(redacted).(map[string]interface{})
+	}
+	record.ArgsDigest = Digest(redacted)
+	record.Error = l.redactor.String(record.Error)
+	if l.logArguments {
+		record.Arguments = redacted
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return fmt.Errorf("audit: log is closed")
+	}
+	var rotateErr error
+	if l.size > 0 && l.size+int64(len(line)) > l.maxBytes {
+		// A failed rotation is retried on the next record; this one still goes to the current file
+		if rotateErr = l.rotate(); l.file == nil {
+			return rotateErr
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return rotateErr
+}
+
+// rotate shifts audit.jsonl to audit.jsonl.1, .1 to .2 and so on, dropping the oldest file
+// The log is reopened even if a rename fails, so a failed rotation does not stop auditing.
+// Must be called with l.mu held.
+func (l *Logger) rotate() error {
+	err := l.file.Close()
+	l.file = nil
+	if err == nil {
+		os.Remove(backupName(l.path, l.maxBackups))
+		for i := l.maxBackups - 1; i >= 0; i-- {
+			if err = os.Rename(backupName(l.path, i), backupName(l.path, i+1)); err != nil && !os.IsNotExist(err) {
+				break
+			}
+			err = nil
+		}
+	}
+	if openErr := l.openFile(); openErr != nil {
+		return openErr
+	}
+	if err != nil {
+		return fmt.Errorf("audit: failed to rotate %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// Close closes the audit log
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// backupName returns the name of the n-th rotated file, or the log itself for n == 0
+func backupName(logPath string, n int) string {
+	if n == 0 {
+		return logPath
+	}
+	return fmt.Sprintf("%s.%d", logPath, n)
+}
+
+// redactArguments returns a copy of arguments with the values of matching names replaced,
+// at any depth; names are matched case-insensitively
+func (l *Logger) redactArguments(arguments map[string]interface{}) map[string]interface{} {
+	if arguments == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(arguments))
+	for name, value := range arguments {
+		if l.redactName(name) {
+			redacted[name] = Redacted
+			continue
+		}
+		redacted[name] = l.redactValue(value)
+	}
+	return redacted
+}
+
+func (l *Logger) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return l.redactArguments(v)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = l.redactValue(item)
+		}
+		return items
+	default:
+		return value
+	}
+}
+
+func (l *Logger) redactName(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range l.redact {
+		if matched, _ := path.Match(strings.ToLower(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Digest returns the SHA-256 of arguments as JSON; map keys are sorted, so equal arguments
+// always have the same digest
+func Digest(arguments map[string]interface{}) string {
+	data, err := json.Marshal(arguments)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+)
+
+func TestRedactAndDigestArguments(t *testing.T) {
+	logger, err := Open(&config.AuditConfig{Path: filepath.Join(t.TempDir(), "audit.jsonl")}, nil)
+	require.NoError(t, err)
+	defer logger.Close()
+
+	redacted := logger.redactArguments(map[string]interface{}{
+		"query":   "bugs",
+		"Api_Key": "k",
+		"auth":    map[string]interface{}{"password": "p", "user": "me"},
+		"headers": []interface{}{map[string]interface{}{"Authorization": "Bearer x"}},
+	})
+	assert.Equal(t, map[string]interface{}{
+		"query":   "bugs",
+		"Api_Key": Redacted,
+		"auth":    map[string]interface{}{"password": Redacted, "user": "me"},
+		"headers": []interface{}{map[string]interface{}{"Authorization": Redacted}},
+	}, redacted)
+
+	assert.Equal(t,
+		Digest(map[string]interface{}{"a": 1, "b": "x"}),
+		Digest(map[string]interface{}{"b": "x", "a": 1}),
+		"the digest does not depend on key order")
+	assert.NotEqual(t, Digest(map[string]interface{}{"a": 1}), Digest(map[string]interface{}{"a": 2}))
+
+	_, err = Open(&config.AuditConfig{Path: filepath.Join(t.TempDir(), "audit.jsonl"), RedactArguments: []string{"["}}, nil)
+	assert.ErrorContains(t, err, "invalid redactArguments pattern")
+}
+
+func TestLoggerRotatesAndQueriesAllFiles(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	logger, err := Open(&config.AuditConfig{Path: logPath, MaxBackups: 2}, nil)
+	require.NoError(t, err)
+	logger.maxBytes = 400 // A few records per file
+
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 12; i++ {
+		record := Record{
+			Time:     start.Add(time.Duration(i) * time.Minute),
+			Caller:   "ci",
+			ToolPath: "github.create_issue",
+			Server:   "github",
+		}
+		if i%2 == 1 {
+			record.Caller, record.ToolPath, record.Server = "local", "filesystem.read_file", "filesystem"
+			record.ErrorClass = "timeout"
+		}
+		require.NoError(t, logger.Log(record, map[string]interface{}{"n": i}))
+	}
+	require.NoError(t, logger.Close())
+
+	files := Files(logPath)
+	assert.Equal(t, []string{logPath + ".2", logPath + ".1", logPath}, files)
+	_, err = os.Stat(logPath + ".3")
+	assert.True(t, os.IsNotExist(err), "only maxBackups rotated files are kept")
+	for _, name := range files {
+		info, err := os.Stat(name)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, info.Size(), int64(400))
+	}
+
+	all, err := Query(logPath, Filter{}, 0)
+	require.NoError(t, err)
+	require.NotEmpty(t, all)
+	for i := 1; i < len(all); i++ {
+		assert.True(t, all[i].Time.After(all[i-1].Time), "records are returned oldest first")
+	}
+	assert.Equal(t, start.Add(11*time.Minute), all[len(all)-1].Time)
+
+	failed, err := Query(logPath, Filter{Failed: true, Tool: "filesystem.*"}, 2)
+	require.NoError(t, err)
+	require.Len(t, failed, 2)
+	assert.Equal(t, start.Add(9*time.Minute), failed[0].Time)
+	assert.Equal(t, "local", failed[1].Caller)
+
+	recent, err := Query(logPath, Filter{Since: start.Add(10 * time.Minute), Caller: "ci"}, 0)
+	require.NoError(t, err)
+	require.Len(t, recent, 1)
+	assert.Equal(t, "github", recent[0].Server)
+
+	_, err = Query(filepath.Join(t.TempDir(), "missing.jsonl"), Filter{}, 0)
+	assert.ErrorContains(t, err, "no audit log")
+}
+
+func TestLoggerKeepsLoggingWhenRotationFails(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	logger, err := Open(&config.AuditConfig{Path: logPath, MaxBackups: 1}, nil)
+	require.NoError(t, err)
+	defer logger.Close()
+	logger.maxBytes = 200
+
+	// The first backup cannot be replaced: a non-empty directory is in its way
+	require.NoError(t, os.MkdirAll(filepath.Join(logPath+".1", "blocked"), 0o700))
+
+	require.NoError(t, logger.Log(Record{ToolPath: "github.get_me"}, nil))
+	err = logger.Log(Record{ToolPath: "github.get_me"}, nil)
+	assert.ErrorContains(t, err, "failed to rotate")
+
+	// Once the way is clear, the next record rotates the log as usual
+	require.NoError(t, os.RemoveAll(logPath+".1"))
+	require.NoError(t, logger.Log(Record{ToolPath: "github.create_issue"}, nil))
+
+	records, err := Query(logPath, Filter{}, 0)
+	require.NoError(t, err)
+	require.Len(t, records, 3, "no record is lost while the rotation fails")
+	assert.Equal(t, "github.create_issue", records[2].ToolPath)
+	assert.Equal(t, []string{logPath + ".1", logPath}, Files(logPath))
+}
+
+func TestLoggerAppendsToExistingLog(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	for i := 0; i < 2; i++ {
+		logger, err := Open(&config.AuditConfig{Path: logPath}, nil)
+		require.NoError(t, err)
+		require.NoError(t, logger.Log(Record{ToolPath: "github.get_me"}, nil))
+		require.NoError(t, logger.Close())
+	}
+	records, err := Query(logPath, Filter{}, 0)
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	info, err := os.Stat(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// Filter selects audit records; zero fields match every record
+type Filter struct {
+	Since  time.Time
+	Caller string
+	Server string
+	// Tool is a glob pattern matched against the tool path, e.g. "github.*"
+	Tool string
+	// Failed keeps only calls that returned an error
+	Failed bool
+}
+
+// Match reports whether record passes the filter
+func (f Filter) Match(record Record) bool {
+	if !f.Since.IsZero() && record.Time.Before(f.Since) {
+		return false
+	}
+	if f.Caller != "" && record.Caller != f.Caller {
+		return false
+	}
+	if f.Server != "" && record.Server != f.Server {
+		return false
+	}
+	if f.Tool != "" {
+		if matched, _ := path.Match(f.Tool, record.ToolPath); !matched {
+			return false
+		}
+	}
+	if f.Failed && record.ErrorClass == "" {
+		return false
+	}
+	return true
+}
+
+// Files returns the audit log and its rotated files that exist, oldest first
+func Files(logPath string) []string {
+	var files []string
+	for n := 1; ; n++ {
+		if _, err := os.Stat(backupName(logPath, n)); err != nil {
+			break
+		}
+		files = append([]string{backupName(logPath, n)}, files...)
+	}
+	if _, err := os.Stat(logPath); err == nil {
+		files = append(files, logPath)
+	}
+	return files
+}
+
+// Query reads the audit log at logPath, including rotated files, and returns the records
+// matching filter in the order they were written. If limit is positive only the last limit
+// records are returned.
+func Query(logPath string, filter Filter, limit int) ([]Record, error) {
+	if _, err := path.Match(filter.Tool, ""); err != nil {
+		return nil, fmt.Errorf("invalid tool pattern %q: %w", filter.Tool, err)
+	}
+	files := Files(logPath)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no audit log at %s", logPath)
+	}
+
+	var records []Record
+	for _, name := range files {
+		err := readFile(name, func(record Record) {
+			if !filter.Match(record) {
+				return
+			}
+			records = append(records, record)
+			if limit > 0 && len(records) > limit {
+				records = records[1:]
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func readFile(name string, fn func(Record)) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		fn(record)
+	}
+	return scanner.Err()
+}
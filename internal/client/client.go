@@ -1,6 +1,7 @@
 package client
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/tracing"
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
@@ -32,6 +34,8 @@ type Client struct {
 	lazyTemplates []mcp.ResourceTemplate
 	activateOnce  sync.Once
 	activated     bool
+	// Health reporting
+	pingFailureHandler func(failCount int, err error)
 }
 
 func NewMCPClient(name string, conf *config.MCPClientConfigV2) (*Client, error) {
@@ -56,7 +60,8 @@ func NewMCPClient(name string, conf *config.MCPClientConfigV2) (*Client, error)
 			options: conf.Options,
 		}, nil
 	case *config.SSEMCPClientConfig:
-		var options []transport.ClientOption
+		// Propagate the trace context of each request
+		options := []transport.ClientOption{client.WithHeaderFunc(tracing.HTTPHeaders)}
 		if len(v.Headers) > 0 {
 			options = append(options, client.WithHeaders(v.Headers))
 		}
@@ -72,7 +77,7 @@ func NewMCPClient(name string, conf *config.MCPClientConfigV2) (*Client, error)
 			options:         conf.Options,
 		}, nil
 	case *config.StreamableMCPClientConfig:
-		var options []transport.StreamableHTTPCOption
+		options := []transport.StreamableHTTPCOption{transport.WithHTTPHeaderFunc(tracing.HTTPHeaders)}
 		if len(v.Headers) > 0 {
 			options = append(options, transport.WithHTTPHeaders(v.Headers))
 		}
@@ -94,6 +99,17 @@ func NewMCPClient(name string, conf *config.MCPClientConfigV2) (*Client, error)
 	return nil, errors.New("invalid client type")
 }
 
+// WrapMCPClient wraps an already constructed mcp-go client, e.g. one using an in-process transport
+// The client is started with Start before Initialize, like the SSE and streamable clients
+func WrapMCPClient(name string, mcpClient *client.Client, options *config.OptionsV2) *Client {
+	return &Client{
+		name:            name,
+		needManualStart: true,
+		client:          mcpClient,
+		options:         options,
+	}
+}
+
 func (c *Client) AddToMCPServer(ctx context.Context, clientInfo mcp.Implementation, mcpServer *server.MCPServer) error {
 	// Store mcpServer reference for later activation
 	c.mcpServer = mcpServer
@@ -314,6 +330,9 @@ func (c *Client) startPingTask(ctx context.Context) {
 				}
 				failCount++
 				log.Printf("<%s> MCP Ping failed: %v (count=%d)", c.name, err, failCount)
+				if c.pingFailureHandler != nil {
+					c.pingFailureHandler(failCount, err)
+				}
 			} else if failCount > 0 {
 				log.Printf("<%s> MCP Ping recovered after %d failures", c.name, failCount)
 				failCount = 0
@@ -602,6 +621,30 @@ func (c *Client) GetClient() *client.Client {
 	return c.client
 }
 
+// WatchProcess logs the stderr of a stdio server process and calls onExit once the process has
+// closed it, which it does when it exits, including when the client is closed. It returns false
+// for transports without a process of their own.
+func (c *Client) WatchProcess(onExit func(err error)) bool {
+	stderr, ok := client.GetStderr(c.client)
+	if !ok || stderr == nil {
+		return false
+	}
+	go func() {
+		reader := bufio.NewReader(stderr)
+		for {
+			line, err := reader.ReadString('\n')
+			if line = strings.TrimRight(line, "\r\n"); line != "" {
+				log.Printf("<%s> %s", c.name, line)
+			}
+			if err != nil {
+				onExit(err)
+				return
+			}
+		}
+	}()
+	return true
+}
+
 // NeedManualStart returns whether the client needs manual start
 func (c *Client) NeedManualStart() bool {
 	return c.needManualStart
@@ -617,6 +660,12 @@ func (c *Client) StartPingTask(ctx context.Context) {
 	c.startPingTask(ctx)
 }
 
+// SetPingFailureHandler registers a callback invoked after every failed ping with the consecutive failure count
+// Must be called before the ping task is started
+func (c *Client) SetPingFailureHandler(handler func(failCount int, err error)) {
+	c.pingFailureHandler = handler
+}
+
 type Server struct {
 	tokens    []string
 	mcpServer *server.MCPServer
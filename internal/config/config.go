@@ -2,7 +2,9 @@ package config
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"errors"
+	"fmt"
 	nethttp "net/http"
 	"strings"
 	"time"
@@ -48,6 +50,40 @@ const (
 	MCPServerTypeStreamable MCPServerType = "streamable-http"
 )
 
+// Duration is a time.Duration that reads from JSON as a Go duration string ("30s", "5m")
+// or as a number of milliseconds
+type Duration time.Duration
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	switch v := raw.(type) {
+	case nil:
+		*d = 0
+	case float64:
+		*d = Duration(time.Duration(v * float64(time.Millisecond)))
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", v, err)
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration: %s", string(data))
+	}
+	return nil
+}
+
 // ---- V2 ----
 
 type ToolFilterMode string
@@ -62,6 +98,71 @@ type ToolFilterConfig struct {
 	List []string       `json:"list,omitempty"`
 }
 
+// ToolPolicy allows or denies hierarchy tool paths by glob pattern, e.g. "github.*" or "filesystem.write_*"
+// Deny wins over allow; an empty allow list allows every tool that is not denied.
+type ToolPolicy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// ApprovalConfig makes tool calls wait for a human decision from a local hook
+type ApprovalConfig struct {
+	// Destructive requires approval for every tool annotated with destructiveHint
+	Destructive bool `json:"destructive,omitempty"`
+	// Tools lists tool path patterns that require approval
+	Tools []string `json:"tools,omitempty"`
+	// Webhook receives the pending call as a JSON POST and answers {"approved": true|false}
+	Webhook string `json:"webhook,omitempty"`
+	// Command receives the pending call as JSON on stdin and approves it by exiting with status 0
+	Command []string `json:"command,omitempty"`
+	// Timeout bounds the wait for a decision; a call without a decision is rejected
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+// AuditConfig writes a JSONL record of every execute_tool call
+type AuditConfig struct {
+	// Path of the audit log; rotated files get a numeric suffix (audit.jsonl.1 is the newest)
+	Path string `json:"path"`
+	// MaxSizeMB rotates the log once it would grow beyond this size (default 100)
+	MaxSizeMB int `json:"maxSizeMB,omitempty"`
+	// MaxBackups is the number of rotated files to keep (default 5)
+	MaxBackups int `json:"maxBackups,omitempty"`
+	// LogArguments stores the arguments themselves next to their digest
+	LogArguments bool `json:"logArguments,omitempty"`
+	// RedactArguments lists argument name patterns whose values are replaced before digesting or logging
+	RedactArguments []string `json:"redactArguments,omitempty"`
+}
+
+// RedactConfig scrubs secrets from tool results, logs and audit records
+type RedactConfig struct {
+	// Patterns are regular expressions to redact; with capture groups only the groups are redacted
+	Patterns []string `json:"patterns,omitempty"`
+	// ConfigValues also redacts the env and header values of every server and the authTokens (default true)
+	ConfigValues optional.Field[bool] `json:"configValues,omitempty"`
+}
+
+// TracingConfig exports spans of tool calls over OTLP/HTTP to a collector, or as JSON to a file
+type TracingConfig struct {
+	// Endpoint of an OTLP/HTTP collector, e.g. "http://localhost:4318"; spans are sent to /v1/traces
+	Endpoint string            `json:"endpoint,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	// File receives the spans instead, one JSON object per span as written by the stdout exporter
+	File        string `json:"file,omitempty"`
+	ServiceName string `json:"serviceName,omitempty"`
+	// FlushInterval is how often finished spans are exported (default 5s)
+	FlushInterval Duration `json:"flushInterval,omitempty"`
+}
+
+// MetricsConfig serves Prometheus metrics on /metrics
+type MetricsConfig struct {
+	// Addr is a separate listen address for /metrics, e.g. ":9090", outside of authTokens.
+	// When empty, /metrics is served next to the MCP endpoint and requires an auth token like it.
+	Addr string `json:"addr,omitempty"`
+}
+
+// OptionsV2 holds the options of mcpProxy and of each server in mcpServers, which inherits unset ones
+// The options from PinnedTools on apply to mcpProxy only, and each of those features is off
+// unless its option is set.
 type OptionsV2 struct {
 	PanicIfInvalid    optional.Field[bool] `json:"panicIfInvalid,omitempty"`
 	LogEnabled        optional.Field[bool] `json:"logEnabled,omitempty"`
@@ -69,6 +170,55 @@ type OptionsV2 struct {
 	RecursiveLazyLoad optional.Field[bool] `json:"recursiveLazyLoad,omitempty"`
 	AuthTokens        []string             `json:"authTokens,omitempty"`
 	ToolFilter        *ToolFilterConfig    `json:"toolFilter,omitempty"`
+
+	// ToolTimeout bounds a single execute_tool call; on mcpProxy it is the default for every server
+	ToolTimeout Duration `json:"toolTimeout,omitempty"`
+
+	// IdleTimeout closes a lazily started server after this long without use; zero keeps it running.
+	// KeepAlive exempts a server from idle shutdown.
+	IdleTimeout Duration             `json:"idleTimeout,omitempty"`
+	KeepAlive   optional.Field[bool] `json:"keepAlive,omitempty"`
+
+	// Preload starts the server in the background when the proxy starts instead of on first use
+	Preload optional.Field[bool] `json:"preload,omitempty"`
+
+	// PinnedTools lists hierarchy tool paths published as direct MCP tools
+	PinnedTools []string `json:"pinnedTools,omitempty"`
+
+	// Dynamic tool promotion: tools an agent discovers or uses are registered as direct
+	// MCP tools until they go unused for PromotionTurns tool calls or for PromotionTTL
+	PromoteTools   optional.Field[bool] `json:"promoteTools,omitempty"`
+	PromotionTurns int                  `json:"promotionTurns,omitempty"`
+	PromotionTTL   Duration             `json:"promotionTTL,omitempty"`
+
+	// Stateful sessions for the streamable-http front-end: clients get an Mcp-Session-Id
+	// and the proxy tracks each session until it goes unused for SessionTimeout
+	StatefulSessions optional.Field[bool] `json:"statefulSessions,omitempty"`
+	SessionTimeout   Duration             `json:"sessionTimeout,omitempty"`
+
+	// Tool authorization: Policies are keyed by caller identity, which is the label
+	// TokenLabels gives the bearer token, the token itself, or DefaultIdentity for callers without a
+	// token such as stdio clients. "*" matches every other caller.
+	TokenLabels     map[string]string      `json:"tokenLabels,omitempty"`
+	DefaultIdentity string                 `json:"defaultIdentity,omitempty"`
+	Policies        map[string]*ToolPolicy `json:"policies,omitempty"`
+
+	// Human approval of sensitive tool calls
+	Approval *ApprovalConfig `json:"approval,omitempty"`
+
+	// Audit log of execute_tool calls
+	Audit *AuditConfig `json:"audit,omitempty"`
+
+	// Secret redaction of tool results, logs and audit records
+	Redact *RedactConfig `json:"redact,omitempty"`
+
+	// OpenTelemetry tracing of tool calls
+	Tracing *TracingConfig `json:"tracing,omitempty"`
+	Metrics *MetricsConfig `json:"metrics,omitempty"`
+
+	// Hierarchy hot reload
+	WatchHierarchy         optional.Field[bool] `json:"watchHierarchy,omitempty"`
+	HierarchyWatchInterval Duration             `json:"hierarchyWatchInterval,omitempty"`
 }
 
 type MCPProxyConfigV2 struct {
@@ -79,6 +229,28 @@ type MCPProxyConfigV2 struct {
 	Type          MCPServerType `json:"type,omitempty"`
 	HierarchyPath string        `json:"hierarchyPath,omitempty"`
 	Options       *OptionsV2    `json:"options,omitempty"`
+
+	// Transports serves the same proxy over several front-ends at once (e.g. stdio and streamable-http)
+	// When set it takes precedence over Type
+	Transports []MCPServerType `json:"transports,omitempty"`
+}
+
+// FrontEnds returns the transports the proxy is served over: Transports when set, otherwise Type
+func (c *MCPProxyConfigV2) FrontEnds() []MCPServerType {
+	if len(c.Transports) > 0 {
+		return c.Transports
+	}
+	return []MCPServerType{c.Type}
+}
+
+// ServesHTTP reports whether any front-end is served over HTTP
+func (c *MCPProxyConfigV2) ServesHTTP() bool {
+	for _, serverType := range c.FrontEnds() {
+		if serverType != MCPServerTypeStdio {
+			return true
+		}
+	}
+	return false
 }
 
 type MCPClientConfigV2 struct {
@@ -184,6 +356,34 @@ func newConfProvider(path string, insecure, expandEnv bool, httpHeaders string,
 	return nil, errors.New("unsupported config path")
 }
 
+// InheritProxyOptions fills options a server config leaves unset from the mcpProxy options
+func InheritProxyOptions(proxyOptions *OptionsV2, clientConfig *MCPClientConfigV2) {
+	if clientConfig.Options == nil {
+		clientConfig.Options = &OptionsV2{}
+	}
+	if proxyOptions == nil {
+		return
+	}
+	if clientConfig.Options.AuthTokens == nil {
+		clientConfig.Options.AuthTokens = proxyOptions.AuthTokens
+	}
+	if !clientConfig.Options.PanicIfInvalid.Present() {
+		clientConfig.Options.PanicIfInvalid = proxyOptions.PanicIfInvalid
+	}
+	if !clientConfig.Options.LogEnabled.Present() {
+		clientConfig.Options.LogEnabled = proxyOptions.LogEnabled
+	}
+	if !clientConfig.Options.LazyLoad.Present() {
+		clientConfig.Options.LazyLoad = proxyOptions.LazyLoad
+	}
+	if clientConfig.Options.ToolTimeout == 0 {
+		clientConfig.Options.ToolTimeout = proxyOptions.ToolTimeout
+	}
+	if clientConfig.Options.IdleTimeout == 0 {
+		clientConfig.Options.IdleTimeout = proxyOptions.IdleTimeout
+	}
+}
+
 func Load(path string, insecure, expandEnv bool, httpHeaders string, httpTimeout int) (*Config, error) {
 	pro, err := newConfProvider(path, insecure, expandEnv, httpHeaders, httpTimeout)
 	if err != nil {
@@ -202,27 +402,18 @@ func Load(path string, insecure, expandEnv bool, httpHeaders string, httpTimeout
 		conf.McpProxy.Options = &OptionsV2{}
 	}
 	for _, clientConfig := range conf.McpServers {
-		if clientConfig.Options == nil {
-			clientConfig.Options = &OptionsV2{}
-		}
-		if clientConfig.Options.AuthTokens == nil {
-			clientConfig.Options.AuthTokens = conf.McpProxy.Options.AuthTokens
-		}
-		if !clientConfig.Options.PanicIfInvalid.Present() {
-			clientConfig.Options.PanicIfInvalid = conf.McpProxy.Options.PanicIfInvalid
-		}
-		if !clientConfig.Options.LogEnabled.Present() {
-			clientConfig.Options.LogEnabled = conf.McpProxy.Options.LogEnabled
-		}
-		if !clientConfig.Options.LazyLoad.Present() {
-			clientConfig.Options.LazyLoad = conf.McpProxy.Options.LazyLoad
-		}
+		InheritProxyOptions(conf.McpProxy.Options, clientConfig)
 	}
 
 	if conf.McpProxy.Type == "" {
 		conf.McpProxy.Type = MCPServerTypeSSE // default to SSE
 	}
 
+	// Without an HTTP front-end there is no endpoint to serve /metrics next to
+	if metrics := conf.McpProxy.Options.Metrics; metrics != nil && metrics.Addr == "" && !conf.McpProxy.ServesHTTP() {
+		return nil, errors.New("metrics.addr is required when the proxy is only served over stdio")
+	}
+
 	return &Config{
 		McpProxy:   conf.McpProxy,
 		McpServers: conf.McpServers,
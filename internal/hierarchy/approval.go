@@ -0,0 +1,122 @@
+package hierarchy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+)
+
+// ApprovalRequest describes a tool call that waits for a human decision
+type ApprovalRequest struct {
+	ToolPath    string                 `json:"tool_path"`
+	Server      string                 `json:"server"`
+	Tool        string                 `json:"tool"`
+	Arguments   map[string]interface{} `json:"arguments"`
+	Annotations map[string]interface{} `json:"annotations,omitempty"`
+	// Reason says why the call needs approval, e.g. "destructiveHint"
+	Reason string `json:"reason"`
+}
+
+// Approver asks a human whether a tool call may run
+// It returns false, or an error, to reject the call.
+type Approver interface {
+	Approve(ctx context.Context, request ApprovalRequest) (bool, error)
+}
+
+// ApprovalPolicy decides which tool calls need approval and who gives it
+// Tools with "require_approval": true in the hierarchy always need approval.
+type ApprovalPolicy struct {
+	// destructive requires approval for every tool annotated with destructiveHint
+	destructive bool
+	tools       []*regexp.Regexp
+	approver    Approver
+}
+
+// NewApprovalPolicy builds a policy that requires approval for the tool path patterns in tools
+// (see compilePattern), and for destructive tools if destructive is set
+func NewApprovalPolicy(tools []string, destructive bool, approver Approver) (*ApprovalPolicy, error) {
+	policy := &ApprovalPolicy{destructive: destructive, approver: approver}
+	for _, pattern := range tools {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		policy.tools = append(policy.tools, re)
+	}
+	return policy, nil
+}
+
+// approvalReason returns why the tool needs approval, or "" if it does not
+func (p *ApprovalPolicy) approvalReason(toolPath string, toolDef *ToolDefinition) string {
+	if toolDef.RequireApproval {
+		return "require_approval"
+	}
+	if p == nil {
+		return ""
+	}
+	if destructive, _ := toolDef.Annotations["destructiveHint"].(bool); p.destructive && destructive {
+		return "destructiveHint"
+	}
+	for _, re := range p.tools {
+		if re.MatchString(toolPath) {
+			return "approval.tools"
+		}
+	}
+	return ""
+}
+
+type approvalPolicyKey struct{}
+
+// WithApprovalPolicy attaches the approval policy to ctx; HandleExecuteTool enforces it
+func WithApprovalPolicy(ctx context.Context, policy *ApprovalPolicy) context.Context {
+	return context.WithValue(ctx, approvalPolicyKey{}, policy)
+}
+
+// ApprovalPolicyFromContext returns the approval policy attached to ctx, or nil
+func ApprovalPolicyFromContext(ctx context.Context) *ApprovalPolicy {
+	policy, _ := ctx.Value(approvalPolicyKey{}).(*ApprovalPolicy)
+	return policy
+}
+
+// ApprovalDeniedError is returned when a tool call that needs approval is not approved
+type ApprovalDeniedError struct {
+	ToolPath string
+	Reason   string
+	Cause    error // Set when no decision could be obtained
+}
+
+func (e *ApprovalDeniedError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("tool %s needs approval (%s) and was not approved: %v", e.ToolPath, e.Reason, e.Cause)
+	}
+	return fmt.Sprintf("tool %s needs approval (%s) and was rejected", e.ToolPath, e.Reason)
+}
+
+func (e *ApprovalDeniedError) Unwrap() error {
+	return e.Cause
+}
+
+// checkApproval pauses the call until the approver decides, if the tool needs approval
+// Without an approver, such calls are rejected.
+func checkApproval(ctx context.Context, canonicalPath string, toolDef *ToolDefinition, request ApprovalRequest) error {
+	policy := ApprovalPolicyFromContext(ctx)
+	request.Reason = policy.approvalReason(canonicalPath, toolDef)
+	if request.Reason == "" {
+		return nil
+	}
+	if policy == nil || policy.approver == nil {
+		return &ApprovalDeniedError{ToolPath: request.ToolPath, Reason: request.Reason, Cause: fmt.Errorf("no approval hook is configured")}
+	}
+
+	log.Printf("Waiting for approval: hierarchy_path=%s, reason=%s", request.ToolPath, request.Reason)
+	approved, err := policy.approver.Approve(ctx, request)
+	if err != nil {
+		return &ApprovalDeniedError{ToolPath: request.ToolPath, Reason: request.Reason, Cause: err}
+	}
+	if !approved {
+		return &ApprovalDeniedError{ToolPath: request.ToolPath, Reason: request.Reason}
+	}
+	log.Printf("Approved: hierarchy_path=%s", request.ToolPath)
+	return nil
+}
@@ -0,0 +1,93 @@
+package hierarchy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeApprover struct {
+	approve  bool
+	err      error
+	requests []ApprovalRequest
+}
+
+func (a *fakeApprover) Approve(ctx context.Context, request ApprovalRequest) (bool, error) {
+	a.requests = append(a.requests, request)
+	return a.approve, a.err
+}
+
+var approvalNodes = map[string]string{
+	"root.json":               `{"overview": "root"}`,
+	"github/github.json":      `{"mcp_server": {"name": "github", "command": "github-mcp"}}`,
+	"github/delete_repo.json": `{"tools": {"delete_repo": {"annotations": {"destructiveHint": true}}}}`,
+	"github/merge.json":       `{"tools": {"merge": {"maps_to": "merge_pull_request", "require_approval": true}}}`,
+	"github/get_me.json":      `{"tools": {"get_me": {"annotations": {"readOnlyHint": true}}}}`,
+}
+
+func TestExecuteToolRequiresApproval(t *testing.T) {
+	h := newTestHierarchy(t, approvalNodes)
+	registry := NewServerRegistry(nil)
+	defer registry.Close()
+	args := map[string]interface{}{"pr": float64(7)}
+
+	t.Run("require_approval without an approver is rejected", func(t *testing.T) {
+		_, err := h.HandleExecuteTool(context.Background(), registry, "github.merge", args)
+		var denied *ApprovalDeniedError
+		require.ErrorAs(t, err, &denied)
+		assert.Equal(t, "require_approval", denied.Reason)
+		assert.ErrorContains(t, err, "no approval hook is configured")
+	})
+
+	t.Run("destructive tools ask the approver", func(t *testing.T) {
+		approver := &fakeApprover{approve: false}
+		policy, err := NewApprovalPolicy(nil, true, approver)
+		require.NoError(t, err)
+		ctx := WithApprovalPolicy(context.Background(), policy)
+
+		_, err = h.HandleExecuteTool(ctx, registry, "github.delete_repo", args)
+		assert.ErrorContains(t, err, "was rejected")
+
+		require.Len(t, approver.requests, 1)
+		assert.Equal(t, ApprovalRequest{
+			ToolPath:    "github.delete_repo",
+			Server:      "github",
+			Tool:        "delete_repo",
+			Arguments:   args,
+			Annotations: map[string]interface{}{"destructiveHint": true},
+			Reason:      "destructiveHint",
+		}, approver.requests[0])
+	})
+
+	t.Run("approved calls go on to the server", func(t *testing.T) {
+		approver := &fakeApprover{approve: true}
+		policy, err := NewApprovalPolicy([]string{"github.merge"}, false, approver)
+		require.NoError(t, err)
+		ctx := WithApprovalPolicy(context.Background(), policy)
+
+		// The server is not in the registry, so an approved call fails when loading it
+		_, err = h.HandleExecuteTool(ctx, registry, "github.merge", args)
+		assert.ErrorContains(t, err, "failed to get MCP client")
+		require.Len(t, approver.requests, 1)
+		assert.Equal(t, "merge_pull_request", approver.requests[0].Tool)
+
+		// Neither destructive (policy off) nor listed: no approval needed
+		_, err = h.HandleExecuteTool(ctx, registry, "github.delete_repo", args)
+		assert.ErrorContains(t, err, "failed to get MCP client")
+		assert.Len(t, approver.requests, 1)
+	})
+
+	t.Run("approver errors reject the call", func(t *testing.T) {
+		approver := &fakeApprover{err: errors.New("hook unreachable")}
+		policy, err := NewApprovalPolicy([]string{"github.*"}, false, approver)
+		require.NoError(t, err)
+		ctx := WithApprovalPolicy(context.Background(), policy)
+
+		_, err = h.HandleExecuteTool(ctx, registry, "github.get_me", nil)
+		assert.ErrorContains(t, err, "hook unreachable")
+		assert.Equal(t, "approval.tools", approver.requests[0].Reason)
+	})
+}
@@ -0,0 +1,89 @@
+package hierarchy
+
+import (
+	"log"
+	"sort"
+	"strings"
+)
+
+// maxToolNameLength is the longest tool name MCP clients commonly accept
+const maxToolNameLength = 64
+
+// ExposedTool is a hierarchy tool published as a direct MCP tool next to the meta-tools
+type ExposedTool struct {
+	// Name is the MCP tool name derived from the tool path
+	Name     string
+	ToolPath string
+	Tool     *ToolDefinition
+}
+
+// ExposedTools returns the tools of nodes marked "expose": true together with the pinned tool paths,
+// sorted by name and named after their canonical paths. Only tools that run on an MCP server qualify. Unknown pinned paths and tools
+// whose names collide after sanitizing are skipped with a warning.
+func (h *Hierarchy) ExposedTools(pinned []string) []ExposedTool {
+	byPath := make(map[string]*ToolDefinition)
+
+	h.mu.RLock()
+	for nodePath, node := range h.eachNode() {
+		if !node.Expose {
+			continue
+		}
+		for toolName, toolDef := range node.Tools {
+			byPath[toolPathFor(nodePath, toolName)] = toolDef
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, toolPath := range pinned {
+		// Keyed by canonical path, so a tool pinned by an alternative path is not exposed twice
+		toolDef, canonicalPath, err := h.resolveTool(toolPath)
+		if err != nil {
+			log.Printf("Warning: pinned tool %s not found in the hierarchy, skipping it", toolPath)
+			continue
+		}
+		byPath[canonicalPath] = toolDef
+	}
+
+	paths := make([]string, 0, len(byPath))
+	for toolPath, toolDef := range byPath {
+		if toolDef.Server == "" {
+			continue // Meta-tool entries and unwired tools cannot be proxied
+		}
+		paths = append(paths, toolPath)
+	}
+	sort.Strings(paths)
+
+	exposed := make([]ExposedTool, 0, len(paths))
+	takenBy := make(map[string]string)
+	for _, toolPath := range paths {
+		name := ExposedToolName(toolPath)
+		if other, taken := takenBy[name]; taken {
+			log.Printf("Warning: tools %s and %s both map to tool name %s, only exposing %s", other, toolPath, name, other)
+			continue
+		}
+		takenBy[name] = toolPath
+		exposed = append(exposed, ExposedTool{Name: name, ToolPath: toolPath, Tool: byPath[toolPath]})
+	}
+	sort.Slice(exposed, func(i, j int) bool {
+		return exposed[i].Name < exposed[j].Name
+	})
+	return exposed
+}
+
+// ExposedToolName turns a tool path into a name MCP clients accept ("github.create_issue" -> "github_create_issue")
+// Characters outside [A-Za-z0-9_-] become underscores and long names keep their last 64 characters.
+func ExposedToolName(toolPath string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, toolPath)
+
+	// The end of the path (category and tool name) is the most descriptive part
+	if len(name) > maxToolNameLength {
+		name = name[len(name)-maxToolNameLength:]
+	}
+	return name
+}
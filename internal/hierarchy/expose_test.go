@@ -0,0 +1,43 @@
+package hierarchy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExposedTools(t *testing.T) {
+	h := newTestHierarchy(t, map[string]string{
+		"root.json":          `{"tools": {"execute_tool": {"description": "meta-tool entry"}}}`,
+		"github/github.json": `{"mcp_server": {"name": "github", "command": "github-mcp"}}`,
+		"github/issues/issues.json": `{
+			"expose": true,
+			"tools": {"create_issue": {"description": "Create an issue"}, "list_issues": {}}
+		}`,
+		"github/get_me.json": `{"tools": {"get_me": {}}}`,
+		"github/search.json": `{"tools": {"search": {}}}`,
+	})
+
+	// Alternative paths to a tool that is already exposed add nothing
+	exposed := h.ExposedTools([]string{"github.get_me", "github.get_me.get_me", "github.issues.issues.create_issue", "github.unknown", "execute_tool"})
+
+	var names, paths []string
+	for _, tool := range exposed {
+		names = append(names, tool.Name)
+		paths = append(paths, tool.ToolPath)
+	}
+	assert.Equal(t, []string{"github_get_me", "github_issues_create_issue", "github_issues_list_issues"}, names)
+	assert.Equal(t, []string{"github.get_me", "github.issues.create_issue", "github.issues.list_issues"}, paths,
+		"unknown pinned paths and tools without a server are skipped")
+	assert.Equal(t, "Create an issue", exposed[1].Tool.Description)
+}
+
+func TestExposedToolName(t *testing.T) {
+	assert.Equal(t, "coding_tools_serena_find_symbol", ExposedToolName("coding_tools.serena.find_symbol"))
+	assert.Equal(t, "web_fetch-url", ExposedToolName("web/fetch-url"))
+
+	long := ExposedToolName(strings.Repeat("category.", 10) + "tool")
+	assert.Len(t, long, maxToolNameLength)
+	assert.True(t, strings.HasSuffix(long, "category_tool"))
+}
@@ -0,0 +1,129 @@
+package hierarchy
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+)
+
+// toolFilter is the compiled toolFilter of one server
+type toolFilter struct {
+	mode     config.ToolFilterMode
+	patterns []*regexp.Regexp
+}
+
+// compileToolFilter compiles a server's toolFilter; it returns nil when the filter keeps every tool
+// List entries are exact upstream tool names, globs or "/regex/" patterns (see compilePattern).
+func compileToolFilter(serverName string, cfg *config.ToolFilterConfig) (*toolFilter, error) {
+	if cfg == nil || len(cfg.List) == 0 {
+		return nil, nil
+	}
+
+	mode := config.ToolFilterMode(strings.ToLower(string(cfg.Mode)))
+	if mode != config.ToolFilterModeAllow && mode != config.ToolFilterModeBlock {
+		log.Printf("<%s> Unknown tool filter mode: %s, skipping tool filter", serverName, mode)
+		return nil, nil
+	}
+
+	filter := &toolFilter{mode: mode}
+	for _, pattern := range cfg.List {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid toolFilter of server %s: %w", serverName, err)
+		}
+		filter.patterns = append(filter.patterns, re)
+	}
+	return filter, nil
+}
+
+// allows reports whether the upstream tool toolName passes the filter
+func (f *toolFilter) allows(toolName string) bool {
+	matched := false
+	for _, re := range f.patterns {
+		if re.MatchString(toolName) {
+			matched = true
+			break
+		}
+	}
+	if f.mode == config.ToolFilterModeAllow {
+		return matched
+	}
+	return !matched
+}
+
+// serverToolFilters compiles the toolFilter of every server, keyed by server name
+// Servers from config.json take precedence over same-named mcp_server blocks, as in
+// MergeServerConfigs, so the filter of a block they replace is never compiled.
+func serverToolFilters(fromConfig, fromHierarchy map[string]*config.MCPClientConfigV2) (map[string]*toolFilter, error) {
+	filters := make(map[string]*toolFilter)
+	for name, cfg := range fromHierarchy {
+		if _, ok := fromConfig[name]; ok {
+			continue
+		}
+		if err := addToolFilter(filters, name, cfg); err != nil {
+			return nil, err
+		}
+	}
+	for name, cfg := range fromConfig {
+		if err := addToolFilter(filters, name, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return filters, nil
+}
+
+// addToolFilter compiles the toolFilter of the server name into filters
+func addToolFilter(filters map[string]*toolFilter, name string, cfg *config.MCPClientConfigV2) error {
+	var filterCfg *config.ToolFilterConfig
+	if cfg != nil && cfg.Options != nil {
+		filterCfg = cfg.Options.ToolFilter
+	}
+	filter, err := compileToolFilter(name, filterCfg)
+	if err != nil {
+		return err
+	}
+	filters[name] = filter
+	return nil
+}
+
+// pruneFilteredTools removes the tools the filter of their server rejects
+// Tools are matched by their upstream name (maps_to), like the toolFilter of a non-hierarchy server.
+// Leaf nodes left without tools are removed too, so they do not show up as empty categories.
+func pruneFilteredTools(nodes map[string]*HierarchyNode, filters map[string]*toolFilter) {
+	var emptied []string
+	for nodePath, node := range eachNode(nodes) {
+		if len(node.Tools) == 0 {
+			continue // Not a leaf
+		}
+		for toolName, toolDef := range node.Tools {
+			filter := filters[toolDef.Server]
+			if filter == nil || filter.allows(toolDef.MapsTo) {
+				continue
+			}
+			log.Printf("<%s> Filtering out tool %s", toolDef.Server, toolPathFor(nodePath, toolName))
+			delete(node.Tools, toolName)
+		}
+		if len(node.Tools) == 0 && nodePath != "" && len(node.Prompts) == 0 && len(node.Resources) == 0 {
+			emptied = append(emptied, nodePath)
+		}
+	}
+
+	for _, nodePath := range emptied {
+		if !hasChildNodes(nodes, nodePath) {
+			delete(nodes, nodePath)
+		}
+	}
+}
+
+// hasChildNodes reports whether any node lies below nodePath
+func hasChildNodes(nodes map[string]*HierarchyNode, nodePath string) bool {
+	for path := range eachNode(nodes) {
+		if strings.HasPrefix(path, nodePath+".") {
+			return true
+		}
+	}
+	return false
+}
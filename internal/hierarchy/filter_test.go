@@ -0,0 +1,151 @@
+package hierarchy
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+)
+
+// filterNodes is a hierarchy whose github mcp_server block has the given tool_filter
+func filterNodes(githubFilter string) map[string]string {
+	return map[string]string{
+		"root.json": `{"overview": "root"}`,
+		"github/github.json": `{
+			"mcp_server": {"name": "github", "command": "github-mcp", "tool_filter": ` + githubFilter + `}
+		}`,
+		"github/create_issue.json":   `{"tools": {"create_issue": {}}}`,
+		"github/list_issues.json":    `{"tools": {"list_issues": {}}}`,
+		"github/get_me.json":         `{"tools": {"get_me": {"maps_to": "get_authenticated_user"}}}`,
+		"filesystem/filesystem.json": `{"mcp_server": {"name": "filesystem", "command": "fs-mcp"}}`,
+		"filesystem/files.json":      `{"tools": {"read_file": {}, "write_file": {}, "delete_file": {}}}`,
+	}
+}
+
+func TestToolFilterPatterns(t *testing.T) {
+	filter, err := compileToolFilter("github", &config.ToolFilterConfig{
+		Mode: "allow",
+		List: []string{"get_me", "list_*", "/(create|update)_issue/"},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, filter.allows("get_me"))
+	assert.True(t, filter.allows("list_issues"))
+	assert.True(t, filter.allows("update_issue"))
+	assert.False(t, filter.allows("delete_issue"))
+	assert.False(t, filter.allows("get_me_please"), "patterns match the whole name")
+
+	filter, err = compileToolFilter("github", &config.ToolFilterConfig{Mode: "Block", List: []string{"delete_*"}})
+	require.NoError(t, err)
+	assert.False(t, filter.allows("delete_repo"))
+	assert.True(t, filter.allows("get_me"))
+
+	filter, err = compileToolFilter("github", &config.ToolFilterConfig{Mode: "sometimes", List: []string{"get_me"}})
+	require.NoError(t, err)
+	assert.Nil(t, filter, "unknown modes skip the filter like the non-hierarchy servers do")
+
+	_, err = compileToolFilter("github", &config.ToolFilterConfig{Mode: "allow", List: []string{"/(unclosed/"}})
+	assert.ErrorContains(t, err, "invalid toolFilter of server github")
+}
+
+func TestHierarchyToolFilter(t *testing.T) {
+	dir := writeHierarchy(t, filterNodes(`{"mode": "block", "list": ["create_*", "/get_auth.*/"]}`))
+	h, err := LoadHierarchy(dir)
+	require.NoError(t, err)
+
+	t.Run("mcp_server blocks prune their tools at load time", func(t *testing.T) {
+		github, err := h.HandleGetToolsInCategory("github")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"list_issues"}, mapKeys(github["tools"].(map[string]interface{})))
+
+		_, _, err = h.ResolveToolPath("github.create_issue")
+		assert.ErrorContains(t, err, "tool not found")
+
+		// get_me is matched by its upstream name
+		_, _, err = h.ResolveToolPath("github.get_me")
+		assert.ErrorContains(t, err, "tool not found")
+
+		search, err := h.HandleSearchTools("create issue", 10)
+		require.NoError(t, err)
+		for _, result := range search["results"].([]map[string]interface{}) {
+			assert.NotEqual(t, "github.create_issue", result["tool_path"])
+		}
+	})
+
+	t.Run("config.json filters apply to hierarchy servers", func(t *testing.T) {
+		h, err = LoadHierarchyWithServers(dir, map[string]*config.MCPClientConfigV2{
+			"filesystem": {Options: &config.OptionsV2{ToolFilter: &config.ToolFilterConfig{
+				Mode: "allow", List: []string{"read_*"},
+			}}},
+		})
+		require.NoError(t, err)
+
+		fs, err := h.HandleGetToolsInCategory("filesystem")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"read_file"}, mapKeys(fs["tools"].(map[string]interface{})))
+
+		registry := NewServerRegistry(nil)
+		defer registry.Close()
+		_, err = h.HandleExecuteTool(context.Background(), registry, "filesystem.files.write_file", map[string]interface{}{})
+		assert.ErrorContains(t, err, "tool not found", "filtered tools cannot be executed")
+	})
+
+	t.Run("filters survive a reload", func(t *testing.T) {
+		writeNode(t, filepath.Join(dir, "filesystem", "files.json"), `{"tools": {"read_file": {}, "write_file": {}, "read_dir": {}}}`)
+		require.NoError(t, h.Reload())
+
+		fs, err := h.HandleGetToolsInCategory("filesystem")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"read_file", "read_dir"}, mapKeys(fs["tools"].(map[string]interface{})))
+
+		_, _, err = h.ResolveToolPath("github.create_issue")
+		assert.ErrorContains(t, err, "tool not found")
+	})
+}
+
+func TestConfigToolFilterReplacesHierarchyFilter(t *testing.T) {
+	// The broken filter of the mcp_server block is never compiled: config.json replaces it
+	dir := writeHierarchy(t, filterNodes(`{"mode": "block", "list": ["/[/"]}`))
+
+	// The config.json filter of github only blocks get_me, so create_issue is kept
+	h, err := LoadHierarchyWithServers(dir, map[string]*config.MCPClientConfigV2{
+		"github": {Options: &config.OptionsV2{ToolFilter: &config.ToolFilterConfig{
+			Mode: "block", List: []string{"get_authenticated_user"},
+		}}},
+	})
+	require.NoError(t, err)
+
+	github, err := h.HandleGetToolsInCategory("github")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"create_issue", "list_issues"}, mapKeys(github["tools"].(map[string]interface{})))
+
+	_, _, err = h.ResolveToolPath("github.create_issue")
+	assert.NoError(t, err)
+}
+
+func TestHierarchyToolFilterRejectsInvalidPatterns(t *testing.T) {
+	dir := writeHierarchy(t, filterNodes(`{"mode": "block", "list": ["/[/"]}`))
+	_, err := LoadHierarchy(dir)
+	assert.ErrorContains(t, err, "invalid toolFilter of server github")
+
+	// A reload with a broken filter keeps the current tree
+	dir = writeHierarchy(t, filterNodes(`{"mode": "block", "list": ["create_*"]}`))
+	h, err := LoadHierarchy(dir)
+	require.NoError(t, err)
+	writeNode(t, filepath.Join(dir, "github", "github.json"), `{"mcp_server": {"name": "github", "tool_filter": {"mode": "block", "list": ["/[/"]}}}`)
+	assert.Error(t, h.Reload())
+
+	_, _, err = h.ResolveToolPath("github.list_issues")
+	assert.NoError(t, err)
+}
+
+func mapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
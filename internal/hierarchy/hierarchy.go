@@ -3,7 +3,9 @@ package hierarchy
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"iter"
 	"log"
 	"os"
 	"path/filepath"
@@ -11,32 +13,62 @@ import (
 	"sync"
 	"time"
 
-	"github.com/voicetreelab/lazy-mcp/internal/client"
 	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
 // HierarchyNode represents a node in the tool hierarchy
 // Can be a branch node (has children) or leaf node (has tools)
 type HierarchyNode struct {
-	Overview  string                     `json:"overview,omitempty"`
-	Tools     map[string]*ToolDefinition `json:"tools,omitempty"`
-	MCPServer *MCPServerRef              `json:"mcp_server,omitempty"`
+	Overview  string                         `json:"overview,omitempty"`
+	Tools     map[string]*ToolDefinition     `json:"tools,omitempty"`
+	Prompts   map[string]*PromptDefinition   `json:"prompts,omitempty"`
+	Resources map[string]*ResourceDefinition `json:"resources,omitempty"`
+	MCPServer *MCPServerRef                  `json:"mcp_server,omitempty"`
+	// Expose publishes the node's tools as direct MCP tools next to the meta-tools
+	Expose bool `json:"expose,omitempty"`
 }
 
 // ToolDefinition represents a tool in the hierarchy
 type ToolDefinition struct {
-	Description string                 `json:"description,omitempty"`
-	MapsTo      string                 `json:"maps_to,omitempty"`
-	Server      string                 `json:"server,omitempty"`
-	InputSchema map[string]interface{} `json:"inputSchema,omitempty"`
+	Description  string                 `json:"description,omitempty"`
+	MapsTo       string                 `json:"maps_to,omitempty"`
+	Server       string                 `json:"server,omitempty"`
+	InputSchema  map[string]interface{} `json:"inputSchema,omitempty"`
+	OutputSchema map[string]interface{} `json:"outputSchema,omitempty"`
+	Annotations  map[string]interface{} `json:"annotations,omitempty"`
+	TimeoutMs    int                    `json:"timeout_ms,omitempty"` // Overrides the server's toolTimeout
+	// RequireApproval pauses every call until a human approves it (see ApprovalPolicy)
+	RequireApproval bool `json:"require_approval,omitempty"`
+}
+
+// PromptDefinition represents a prompt of an MCP server in the hierarchy
+type PromptDefinition struct {
+	Description string               `json:"description,omitempty"`
+	MapsTo      string               `json:"maps_to,omitempty"`
+	Server      string               `json:"server,omitempty"`
+	Arguments   []mcp.PromptArgument `json:"arguments,omitempty"`
+}
+
+// ResourceDefinition represents a resource of an MCP server in the hierarchy
+type ResourceDefinition struct {
+	Description string `json:"description,omitempty"`
+	URI         string `json:"uri"`
+	MIMEType    string `json:"mimeType,omitempty"`
+	Server      string `json:"server,omitempty"`
 }
 
 // HierarchyNodeData is used for unmarshaling JSON with flexible tool types
 type HierarchyNodeData struct {
-	Overview  string                 `json:"overview,omitempty"`
-	Tools     map[string]interface{} `json:"tools,omitempty"`
-	MCPServer *MCPServerRef          `json:"mcp_server,omitempty"`
+	Overview  string                         `json:"overview,omitempty"`
+	Tools     map[string]interface{}         `json:"tools,omitempty"`
+	Prompts   map[string]*PromptDefinition   `json:"prompts,omitempty"`
+	Resources map[string]*ResourceDefinition `json:"resources,omitempty"`
+	MCPServer *MCPServerRef                  `json:"mcp_server,omitempty"`
+	Expose    bool                           `json:"expose,omitempty"`
 }
 
 // MCPServerRef contains MCP server configuration
@@ -48,13 +80,16 @@ type MCPServerRef struct {
 	Env          map[string]string `json:"env,omitempty"`
 	URL          string            `json:"url,omitempty"`
 	Headers      map[string]string `json:"headers,omitempty"`
+	Timeout      config.Duration   `json:"timeout,omitempty"`
 	ToolMappings map[string]string `json:"tool_mappings,omitempty"` // Maps hierarchy tool names to actual MCP tool names
+	// ToolFilter prunes the server's tools from the hierarchy, like toolFilter in config.json
+	ToolFilter *config.ToolFilterConfig `json:"tool_filter,omitempty"`
 }
 
 // ToClientConfig converts MCPServerRef to MCPClientConfigV2
 func (m *MCPServerRef) ToClientConfig() *config.MCPClientConfigV2 {
 	cfg := &config.MCPClientConfigV2{
-		Options: &config.OptionsV2{},
+		Options: &config.OptionsV2{ToolFilter: m.ToolFilter},
 	}
 
 	switch m.Type {
@@ -71,6 +106,14 @@ func (m *MCPServerRef) ToClientConfig() *config.MCPClientConfigV2 {
 		cfg.TransportType = config.MCPClientTypeStreamable
 		cfg.URL = m.URL
 		cfg.Headers = m.Headers
+		cfg.Timeout = m.Timeout.Duration()
+	default:
+		// No type given, let ParseMCPClientConfigV2 infer it from command/url
+		cfg.Command = m.Command
+		cfg.Args = m.Args
+		cfg.Env = m.Env
+		cfg.URL = m.URL
+		cfg.Headers = m.Headers
 	}
 
 	return cfg
@@ -78,17 +121,81 @@ func (m *MCPServerRef) ToClientConfig() *config.MCPClientConfigV2 {
 
 // Hierarchy manages the hierarchical tool structure
 type Hierarchy struct {
-	rootPath string
-	nodes    map[string]*HierarchyNode
-	mu       sync.RWMutex
+	rootPath      string
+	nodes         map[string]*HierarchyNode
+	serverConfigs map[string]*config.MCPClientConfigV2 // Collected from mcp_server blocks
+	configServers map[string]*config.MCPClientConfigV2 // Servers from config.json, whose toolFilter wins over mcp_server blocks
+	fingerprint   string                               // State of the directory when nodes were read, used by Watch
+	mu            sync.RWMutex
 }
 
 // LoadHierarchy loads the hierarchy from a directory structure
 func LoadHierarchy(hierarchyPath string) (*Hierarchy, error) {
-	h := &Hierarchy{
-		rootPath: hierarchyPath,
-		nodes:    make(map[string]*HierarchyNode),
+	return LoadHierarchyWithServers(hierarchyPath, nil)
+}
+
+// LoadHierarchyWithServers is LoadHierarchy for a proxy that also has servers in config.json
+// Their toolFilter replaces the one of a same-named mcp_server block, at load time and on every Reload.
+func LoadHierarchyWithServers(hierarchyPath string, fromConfig map[string]*config.MCPClientConfigV2) (*Hierarchy, error) {
+	// Fingerprint before reading so a change made while loading is still seen by Watch
+	fingerprint, _ := fingerprintDir(hierarchyPath)
+
+	nodes, err := loadNodes(hierarchyPath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	serverConfigs := applyServerRefs(nodes)
+
+	filters, err := serverToolFilters(fromConfig, serverConfigs)
+	if err != nil {
+		return nil, err
+	}
+	pruneFilteredTools(nodes, filters)
+
+	log.Printf("Loaded %d hierarchy nodes", len(nodes))
+	return &Hierarchy{
+		rootPath:      hierarchyPath,
+		nodes:         nodes,
+		serverConfigs: serverConfigs,
+		configServers: fromConfig,
+		fingerprint:   fingerprint,
+	}, nil
+}
+
+// Reload re-reads the hierarchy directory and atomically swaps in the new tree
+// Unlike LoadHierarchy, any node that fails to parse aborts the reload and the current tree is kept
+func (h *Hierarchy) Reload() error {
+	fingerprint, _ := fingerprintDir(h.rootPath)
+
+	nodes, err := loadNodes(h.rootPath, true)
+	if err != nil {
+		return err
+	}
+
+	serverConfigs := applyServerRefs(nodes)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	filters, err := serverToolFilters(h.configServers, serverConfigs)
+	if err != nil {
+		return err
 	}
+	pruneFilteredTools(nodes, filters)
+
+	h.nodes = nodes
+	h.serverConfigs = serverConfigs
+	h.fingerprint = fingerprint
+
+	log.Printf("Reloaded %d hierarchy nodes from %s", len(nodes), h.rootPath)
+	return nil
+}
+
+// loadNodes reads every node JSON file under hierarchyPath
+// When strict is false, nodes that fail to parse are skipped with a warning
+func loadNodes(hierarchyPath string, strict bool) (map[string]*HierarchyNode, error) {
+	nodes := make(map[string]*HierarchyNode)
 
 	// Load root.json
 	rootFile := filepath.Join(hierarchyPath, "root.json")
@@ -96,8 +203,8 @@ func LoadHierarchy(hierarchyPath string) (*Hierarchy, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to load root node: %w", err)
 	}
-	h.nodes[""] = rootNode
-	h.nodes["/"] = rootNode
+	nodes[""] = rootNode
+	nodes[rootAlias] = rootNode
 
 	// Walk the directory structure and load all nodes
 	err = filepath.Walk(hierarchyPath, func(path string, info os.FileInfo, err error) error {
@@ -145,11 +252,14 @@ func LoadHierarchy(hierarchyPath string) (*Hierarchy, error) {
 
 		node, err := loadNode(path)
 		if err != nil {
+			if strict {
+				return fmt.Errorf("failed to load node at %s: %w", path, err)
+			}
 			log.Printf("Warning: failed to load node at %s: %v", path, err)
 			return nil // Continue loading other nodes
 		}
 
-		h.nodes[hierarchyKey] = node
+		nodes[hierarchyKey] = node
 		log.Printf("Loaded hierarchy node: %s from %s", hierarchyKey, path)
 		return nil
 	})
@@ -158,8 +268,7 @@ func LoadHierarchy(hierarchyPath string) (*Hierarchy, error) {
 		return nil, fmt.Errorf("failed to walk hierarchy: %w", err)
 	}
 
-	log.Printf("Loaded %d hierarchy nodes", len(h.nodes))
-	return h, nil
+	return nodes, nil
 }
 
 // loadNode loads a single node from a JSON file
@@ -178,7 +287,10 @@ func loadNode(path string) (*HierarchyNode, error) {
 	node := &HierarchyNode{
 		Overview:  nodeData.Overview,
 		Tools:     make(map[string]*ToolDefinition),
+		Prompts:   nodeData.Prompts,
+		Resources: nodeData.Resources,
 		MCPServer: nodeData.MCPServer,
+		Expose:    nodeData.Expose,
 	}
 
 	// Parse tools - can be either map[string]interface{} or direct ToolDefinition
@@ -190,16 +302,27 @@ func loadNode(path string) (*HierarchyNode, error) {
 			}
 			if mapsTo, ok := toolMap["maps_to"].(string); ok {
 				tool.MapsTo = mapsTo
-			} else {
-				// Default maps_to is the tool name itself
-				tool.MapsTo = toolName
 			}
+			// Without maps_to the name comes from the server's tool_mappings or the tool name itself,
+			// resolved by applyServerRefs once the whole tree is loaded
 			if server, ok := toolMap["server"].(string); ok {
 				tool.Server = server
 			}
 			if schema, ok := toolMap["inputSchema"].(map[string]interface{}); ok {
 				tool.InputSchema = schema
 			}
+			if schema, ok := toolMap["outputSchema"].(map[string]interface{}); ok {
+				tool.OutputSchema = schema
+			}
+			if annotations, ok := toolMap["annotations"].(map[string]interface{}); ok {
+				tool.Annotations = annotations
+			}
+			if timeoutMs, ok := toolMap["timeout_ms"].(float64); ok {
+				tool.TimeoutMs = int(timeoutMs)
+			}
+			if requireApproval, ok := toolMap["require_approval"].(bool); ok {
+				tool.RequireApproval = requireApproval
+			}
 			node.Tools[toolName] = tool
 		}
 	}
@@ -207,6 +330,40 @@ func loadNode(path string) (*HierarchyNode, error) {
 	return node, nil
 }
 
+// rootAlias is the second path the root node is stored under, so "/" resolves like ""
+const rootAlias = "/"
+
+// eachNode yields every node of nodes with its path, skipping the "/" alias so the root is visited once
+func eachNode(nodes map[string]*HierarchyNode) iter.Seq2[string, *HierarchyNode] {
+	return func(yield func(string, *HierarchyNode) bool) {
+		for nodePath, node := range nodes {
+			if nodePath == rootAlias {
+				continue
+			}
+			if !yield(nodePath, node) {
+				return
+			}
+		}
+	}
+}
+
+// eachNode yields every node of the current tree, see eachNode
+// Must be called with h.mu held.
+func (h *Hierarchy) eachNode() iter.Seq2[string, *HierarchyNode] {
+	return eachNode(h.nodes)
+}
+
+// NodeCount returns the number of nodes in the current tree, not counting the "/" alias of the root
+func (h *Hierarchy) NodeCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	count := 0
+	for range h.eachNode() {
+		count++
+	}
+	return count
+}
+
 // GetRootNode returns the root node of the hierarchy
 func (h *Hierarchy) GetRootNode() *HierarchyNode {
 	h.mu.RLock()
@@ -214,21 +371,34 @@ func (h *Hierarchy) GetRootNode() *HierarchyNode {
 	return h.nodes[""]
 }
 
+// CategoryOptions controls how much detail get_tools_in_category returns
+type CategoryOptions struct {
+	// IncludeSchema adds inputSchema, outputSchema and annotations to each tool entry
+	IncludeSchema bool
+	// Policy hides the tools it denies, and categories without any allowed tool
+	Policy *AccessPolicy
+}
+
 // HandleGetToolsInCategory handles the get_tools_in_category meta-tool
 // Returns a map with path, overview, children info, and tools
 func (h *Hierarchy) HandleGetToolsInCategory(path string) (map[string]interface{}, error) {
+	return h.HandleGetToolsInCategoryWithOptions(path, CategoryOptions{})
+}
+
+// HandleGetToolsInCategoryWithOptions is HandleGetToolsInCategory with control over the tool detail level
+func (h *Hierarchy) HandleGetToolsInCategoryWithOptions(path string, opts CategoryOptions) (map[string]interface{}, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	// Normalize path
-	if path == "/" {
+	if path == rootAlias {
 		path = ""
 	}
 	path = strings.Trim(path, ".")
 
 	// Find the node
 	node, exists := h.nodes[path]
-	if !exists {
+	if !exists || (path != "" && !h.subtreeAllowed(opts.Policy, path)) {
 		return nil, fmt.Errorf("category not found: %s", path)
 	}
 
@@ -246,7 +416,7 @@ func (h *Hierarchy) HandleGetToolsInCategory(path string) (map[string]interface{
 	allChildrenAreLeaves := true
 	aggregatedTools := make(map[string]interface{})
 
-	for nodePath := range h.nodes {
+	for nodePath := range h.eachNode() {
 		if nodePath == path || nodePath == "" {
 			continue
 		}
@@ -272,25 +442,27 @@ func (h *Hierarchy) HandleGetToolsInCategory(path string) (map[string]interface{
 			}
 		}
 
-		if isDirectChild {
+		if isDirectChild && h.subtreeAllowed(opts.Policy, nodePath) {
 			childNode := h.nodes[nodePath]
 			if len(childNode.Tools) > 0 {
-				// Leaf node
-				children[childName] = map[string]interface{}{
-					"is_leaf":    true,
-					"tool_count": len(childNode.Tools),
-				}
-
 				// Aggregate tools from leaf children
+				toolCount := 0
 				for toolName, toolDef := range childNode.Tools {
 					// In flat structure, nodePath already includes the tool name
 					// e.g., "everything.echo" not "everything.echo.echo"
 					toolPath := nodePath
-
-					aggregatedTools[toolName] = map[string]interface{}{
-						"description": toolDef.Description,
-						"tool_path":   toolPath,
+					if !opts.Policy.Allows(toolPathFor(nodePath, toolName)) {
+						continue
 					}
+
+					aggregatedTools[toolName] = toolInfo(toolDef, toolPath, opts)
+					toolCount++
+				}
+
+				// Leaf node
+				children[childName] = map[string]interface{}{
+					"is_leaf":    true,
+					"tool_count": toolCount,
 				}
 			} else {
 				// Branch node
@@ -319,11 +491,11 @@ func (h *Hierarchy) HandleGetToolsInCategory(path string) (map[string]interface{
 			} else {
 				toolPath = path + "." + toolName
 			}
-
-			toolsInfo[toolName] = map[string]interface{}{
-				"description": toolDef.Description,
-				"tool_path":   toolPath,
+			if !opts.Policy.Allows(toolPathFor(path, toolName)) {
+				continue
 			}
+
+			toolsInfo[toolName] = toolInfo(toolDef, toolPath, opts)
 		}
 		response["tools"] = toolsInfo
 	} else if allChildrenAreLeaves && len(aggregatedTools) > 0 {
@@ -333,12 +505,64 @@ func (h *Hierarchy) HandleGetToolsInCategory(path string) (map[string]interface{
 		response["tools"] = make(map[string]interface{})
 	}
 
+	// Prompts and resources are listed on the node that declares them
+	if len(node.Prompts) > 0 {
+		promptsInfo := make(map[string]interface{})
+		for promptName, promptDef := range node.Prompts {
+			if h.serverAllowed(opts.Policy, promptDef.Server) {
+				promptsInfo[promptName] = promptInfo(promptDef, toolPathFor(path, promptName))
+			}
+		}
+		response["prompts"] = promptsInfo
+	}
+	if len(node.Resources) > 0 {
+		resourcesInfo := make(map[string]interface{})
+		for resourceName, resourceDef := range node.Resources {
+			if h.serverAllowed(opts.Policy, resourceDef.Server) {
+				resourcesInfo[resourceName] = resourceInfo(resourceDef)
+			}
+		}
+		response["resources"] = resourcesInfo
+	}
+
 	return response, nil
 }
 
+// toolInfo builds the per-tool entry of a get_tools_in_category response
+func toolInfo(toolDef *ToolDefinition, toolPath string, opts CategoryOptions) map[string]interface{} {
+	info := map[string]interface{}{
+		"description": toolDef.Description,
+		"tool_path":   toolPath,
+	}
+	if opts.IncludeSchema {
+		if toolDef.InputSchema != nil {
+			info["inputSchema"] = toolDef.InputSchema
+		}
+		if toolDef.OutputSchema != nil {
+			info["outputSchema"] = toolDef.OutputSchema
+		}
+		if toolDef.Annotations != nil {
+			info["annotations"] = toolDef.Annotations
+		}
+	}
+	return info
+}
+
 // ResolveToolPath resolves a tool path to its definition and server name
 // Returns the tool definition, server name (empty for meta-tools or if not configured), and any error
 func (h *Hierarchy) ResolveToolPath(toolPath string) (*ToolDefinition, string, error) {
+	toolDef, _, err := h.resolveTool(toolPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Return the tool and its server name (from the tool-level server field)
+	return toolDef, toolDef.Server, nil
+}
+
+// resolveTool resolves a tool path to its definition and canonical path
+// Several paths can resolve to the same tool; the canonical path is the one the hierarchy lists it under.
+func (h *Hierarchy) resolveTool(toolPath string) (*ToolDefinition, string, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
@@ -349,6 +573,7 @@ func (h *Hierarchy) ResolveToolPath(toolPath string) (*ToolDefinition, string, e
 	}
 
 	var foundTool *ToolDefinition
+	var foundPath string
 
 	// Strategy 1: Check if the full path is a node, and look for a tool with the same name as the last part
 	// e.g., "everything.echo" -> check node "everything.echo" for tool "echo"
@@ -356,6 +581,7 @@ func (h *Hierarchy) ResolveToolPath(toolPath string) (*ToolDefinition, string, e
 	if node, exists := h.nodes[toolPath]; exists {
 		if tool, ok := node.Tools[lastPart]; ok {
 			foundTool = tool
+			foundPath = toolPathFor(toolPath, lastPart)
 		}
 	}
 
@@ -384,6 +610,7 @@ func (h *Hierarchy) ResolveToolPath(toolPath string) (*ToolDefinition, string, e
 				// Check if this node has the tool
 				if tool, ok := node.Tools[toolName]; ok {
 					foundTool = tool
+					foundPath = toolPathFor(categoryPath, toolName)
 					break
 				}
 			}
@@ -394,139 +621,221 @@ func (h *Hierarchy) ResolveToolPath(toolPath string) (*ToolDefinition, string, e
 		return nil, "", fmt.Errorf("tool not found: %s", toolPath)
 	}
 
-	// Return the tool and its server name (from the tool-level server field)
-	return foundTool, foundTool.Server, nil
+	return foundTool, foundPath, nil
+}
+
+// HandleDescribeTool handles the describe_tool meta-tool
+// Returns the full contract of a single tool so agents can call it without browsing its category
+func (h *Hierarchy) HandleDescribeTool(toolPath string) (map[string]interface{}, error) {
+	toolDef, canonicalPath, err := h.resolveTool(toolPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Aliases are answered with the path get_tools_in_category and search_tools list the tool under
+	response := map[string]interface{}{
+		"tool_path":   canonicalPath,
+		"description": toolDef.Description,
+		"maps_to":     toolDef.MapsTo,
+		"server":      toolDef.Server,
+	}
+	if toolDef.InputSchema != nil {
+		response["inputSchema"] = toolDef.InputSchema
+	}
+	if toolDef.OutputSchema != nil {
+		response["outputSchema"] = toolDef.OutputSchema
+	}
+	if toolDef.Annotations != nil {
+		response["annotations"] = toolDef.Annotations
+	}
+
+	return response, nil
+}
+
+// Execution describes an execute_tool call as far as HandleExecuteTool got with it
+// Attach one with WithExecution to learn where a call went, e.g. for auditing.
+type Execution struct {
+	ToolPath string
+	// CanonicalPath is the path the hierarchy lists the tool under, empty if ToolPath did not resolve
+	CanonicalPath string
+	Server        string
+	// Tool is the tool name on the server, after maps_to
+	Tool string
+	// Dispatched is set once the call was sent to the server
+	Dispatched bool
+	// Validation is set when the arguments did not match the inputSchema; the call then
+	// returns an isError result instead of an error
+	Validation *ValidationError
+}
+
+type executionKey struct{}
+
+// WithExecution attaches exec to ctx; HandleExecuteTool fills it in
+func WithExecution(ctx context.Context, exec *Execution) context.Context {
+	return context.WithValue(ctx, executionKey{}, exec)
+}
+
+// ExecutionFromContext returns the Execution attached with WithExecution, or nil
+func ExecutionFromContext(ctx context.Context) *Execution {
+	exec, _ := ctx.Value(executionKey{}).(*Execution)
+	return exec
 }
 
 // HandleExecuteTool handles the execute_tool meta-tool
 func (h *Hierarchy) HandleExecuteTool(ctx context.Context, registry *ServerRegistry, toolPath string, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	exec := ExecutionFromContext(ctx)
+	if exec == nil {
+		exec = &Execution{}
+	}
+	exec.ToolPath = toolPath
+
 	// Resolve the tool path to get tool definition and server name
-	toolDef, serverName, err := h.ResolveToolPath(toolPath)
+	toolDef, canonicalPath, err := h.resolveTool(toolPath)
 	if err != nil {
 		return nil, err
 	}
+	serverName := toolDef.Server
+	exec.CanonicalPath = canonicalPath
+
+	// Use the mapped tool name
+	actualToolName := toolDef.MapsTo
+	if actualToolName == "" {
+		actualToolName = strings.Split(toolPath, ".")[len(strings.Split(toolPath, "."))-1]
+	}
+	exec.Server, exec.Tool = serverName, actualToolName
+
+	// Reject tools the caller's policy denies before anything else
+	if err := h.CheckAccess(AccessPolicyFromContext(ctx), toolPath); err != nil {
+		return nil, err
+	}
 
 	if serverName == "" {
 		return nil, fmt.Errorf("no MCP server configured for tool: %s", toolPath)
 	}
 
+	// Reject bad arguments before paying for a server cold start, with a result the model can act on
+	var validationErr *ValidationError
+	if err := ValidateArguments(toolPath, toolDef.InputSchema, arguments); errors.As(err, &validationErr) {
+		exec.Validation = validationErr
+		return validationErr.Result(), nil
+	}
+
+	// Calls that need a human decision wait for it before the server is started
+	if err := checkApproval(ctx, canonicalPath, toolDef, ApprovalRequest{
+		ToolPath:    toolPath,
+		Server:      serverName,
+		Tool:        actualToolName,
+		Arguments:   arguments,
+		Annotations: toolDef.Annotations,
+	}); err != nil {
+		return nil, err
+	}
+
 	// Get or load the MCP client for this server
 	client, err := registry.GetOrLoadServer(ctx, serverName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get MCP client: %w", err)
 	}
+	defer registry.TrackCall(serverName, client)()
 
-	// Use the mapped tool name
-	actualToolName := toolDef.MapsTo
-	if actualToolName == "" {
-		actualToolName = strings.Split(toolPath, ".")[len(strings.Split(toolPath, "."))-1]
-	}
+	serverCfg, _ := registry.ServerConfig(serverName)
+	timeout, timeoutSource := effectiveTimeout(toolDef, serverCfg)
 
-	log.Printf("Executing tool: hierarchy_path=%s, server=%s, tool=%s", toolPath, serverName, actualToolName)
+	log.Printf("Executing tool: hierarchy_path=%s, server=%s, tool=%s, timeout=%s", toolPath, serverName, actualToolName, timeout)
 
-	// Create a context with 15-second timeout for tool execution
-	toolCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	// Create a context with the effective timeout for tool execution
+	toolCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
+	toolCtx, span := tracing.Start(toolCtx, "CallTool "+actualToolName, trace.SpanKindClient,
+		attribute.String("mcp.server", serverName),
+		attribute.String("mcp.tool", actualToolName),
+		attribute.String("mcp.tool_path", toolPath),
+	)
+	defer span.End()
 
 	// Call the tool on the actual MCP server
 	callRequest := mcp.CallToolRequest{}
 	callRequest.Params.Name = actualToolName
 	callRequest.Params.Arguments = arguments
 
+	// HTTP transports send the trace context as a header; stdio has no headers, so it goes in _meta
+	if traceparent := tracing.Traceparent(toolCtx); traceparent != "" && isStdioServer(serverCfg) {
+		callRequest.Params.Meta = &mcp.Meta{AdditionalFields: map[string]any{tracing.TraceparentHeader: traceparent}}
+	}
+
+	exec.Dispatched = true
+	start := time.Now()
 	result, err := client.GetClient().CallTool(toolCtx, callRequest)
+	elapsed := time.Since(start)
 	if err != nil {
-		return nil, fmt.Errorf("failed to call tool %s: %w", actualToolName, err)
+		tracing.RecordError(span, err)
+		if ctx.Err() == nil {
+			// Unless the caller gave up, the error or the timeout says something about the server
+			registry.ReportFailure(serverName, client, err)
+		}
+		if errors.Is(toolCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			return nil, &ToolTimeoutError{
+				ToolPath: toolPath,
+				Server:   serverName,
+				Timeout:  timeout,
+				Elapsed:  elapsed,
+				Source:   timeoutSource,
+			}
+		}
+		return nil, fmt.Errorf("failed to call tool %s on server %s after %s (timeout %s): %w",
+			actualToolName, serverName, elapsed.Round(time.Millisecond), timeout, err)
+	}
+	registry.ReportSuccess(serverName)
+	if result != nil && result.IsError {
+		tracing.RecordError(span, errors.New("tool returned an error"))
 	}
 
 	return result, nil
 }
 
-// ServerRegistry manages MCP client connections
-type ServerRegistry struct {
-	clients       map[string]*client.Client
-	serverConfigs map[string]*config.MCPClientConfigV2
-	mu            sync.RWMutex
-}
-
-// NewServerRegistry creates a new server registry with server configurations
-func NewServerRegistry(serverConfigs map[string]*config.MCPClientConfigV2) *ServerRegistry {
-	return &ServerRegistry{
-		clients:       make(map[string]*client.Client),
-		serverConfigs: serverConfigs,
+// isStdioServer reports whether cfg starts a local process, as opposed to connecting over HTTP
+func isStdioServer(cfg *config.MCPClientConfigV2) bool {
+	if cfg == nil {
+		return false
 	}
-}
-
-// GetOrLoadServer gets an existing client or creates and initializes a new one
-// This implements lazy loading - servers are only started when first accessed
-func (r *ServerRegistry) GetOrLoadServer(ctx context.Context, serverName string) (*client.Client, error) {
-	// First check with read lock
-	r.mu.RLock()
-	if client, exists := r.clients[serverName]; exists {
-		r.mu.RUnlock()
-		return client, nil
-	}
-	r.mu.RUnlock()
-
-	// Need to create, use write lock
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	// Check again in case another goroutine created it
-	if client, exists := r.clients[serverName]; exists {
-		return client, nil
-	}
-
-	// Look up the server config
-	cfg, exists := r.serverConfigs[serverName]
-	if !exists {
-		return nil, fmt.Errorf("server config not found: %s", serverName)
-	}
-
-	// Create the MCP client
-	mcpClient, err := client.NewMCPClient(serverName, cfg)
+	parsed, err := config.ParseMCPClientConfigV2(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create MCP client: %w", err)
-	}
-
-	// Start the client if needed
-	if mcpClient.NeedManualStart() {
-		err := mcpClient.GetClient().Start(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("failed to start MCP client: %w", err)
-		}
+		return false
 	}
+	_, stdio := parsed.(*config.StdioMCPClientConfig)
+	return stdio
+}
 
-	// Initialize the client
-	initRequest := mcp.InitializeRequest{}
-	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
-	initRequest.Params.ClientInfo = mcp.Implementation{Name: "mcp-proxy-recursive"}
-	initRequest.Params.Capabilities = mcp.ClientCapabilities{}
+// DefaultToolTimeout applies when neither the tool nor its server configures a timeout
+const DefaultToolTimeout = 15 * time.Second
 
-	_, err = mcpClient.GetClient().Initialize(ctx, initRequest)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize MCP client: %w", err)
+// effectiveTimeout picks the timeout for a tool call and reports where it came from:
+// the tool's timeout_ms, the server's toolTimeout (which inherits mcpProxy's), or the default
+func effectiveTimeout(toolDef *ToolDefinition, serverCfg *config.MCPClientConfigV2) (time.Duration, string) {
+	if toolDef.TimeoutMs > 0 {
+		return time.Duration(toolDef.TimeoutMs) * time.Millisecond, "tool timeout_ms"
 	}
-
-	log.Printf("Created and initialized MCP client for server: %s", serverName)
-
-	// Store the client
-	r.clients[serverName] = mcpClient
-
-	// Start ping task if needed
-	if mcpClient.NeedPing() {
-		go mcpClient.StartPingTask(ctx)
+	if serverCfg != nil && serverCfg.Options != nil && serverCfg.Options.ToolTimeout > 0 {
+		return serverCfg.Options.ToolTimeout.Duration(), "server toolTimeout"
 	}
+	return DefaultToolTimeout, "default"
+}
 
-	return mcpClient, nil
+// ToolTimeoutError is returned when a downstream tool call exceeds its timeout,
+// so callers can tell a slow tool apart from a tool that failed
+type ToolTimeoutError struct {
+	ToolPath string
+	Server   string
+	Timeout  time.Duration
+	Elapsed  time.Duration
+	Source   string
 }
 
-// Close closes all clients in the registry
-func (r *ServerRegistry) Close() {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func (e *ToolTimeoutError) Error() string {
+	return fmt.Sprintf("tool %s on server %s timed out after %s (timeout %s from %s); the tool did not fail, it did not answer in time",
+		e.ToolPath, e.Server, e.Elapsed.Round(time.Millisecond), e.Timeout, e.Source)
+}
 
-	for name, client := range r.clients {
-		log.Printf("Closing MCP client: %s", name)
-		_ = client.Close()
-	}
+func (e *ToolTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
 }
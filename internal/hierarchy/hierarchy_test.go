@@ -0,0 +1,123 @@
+package hierarchy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+)
+
+func loadTestHierarchy(t *testing.T) *Hierarchy {
+	t.Helper()
+	h, err := LoadHierarchy(filepath.Join("..", "..", "testdata", "mcp_hierarchy"))
+	require.NoError(t, err)
+	return h
+}
+
+// writeNode writes one hierarchy node file, creating its directory
+func writeNode(t *testing.T, path string, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+// writeHierarchy writes nodes, keyed by their slash-separated path below the root, to a temporary hierarchy directory
+func writeHierarchy(t *testing.T, nodes map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for path, content := range nodes {
+		writeNode(t, filepath.Join(dir, filepath.FromSlash(path)), content)
+	}
+	return dir
+}
+
+// newTestHierarchy loads a hierarchy made of nodes, see writeHierarchy
+func newTestHierarchy(t *testing.T, nodes map[string]string) *Hierarchy {
+	t.Helper()
+	h, err := LoadHierarchy(writeHierarchy(t, nodes))
+	require.NoError(t, err)
+	return h
+}
+
+func TestEachNodeVisitsTheRootOnce(t *testing.T) {
+	h := newTestHierarchy(t, map[string]string{
+		"root.json":          `{"overview": "root"}`,
+		"github/github.json": `{"tools": {"get_me": {"server": "github"}}}`,
+	})
+
+	var paths []string
+	for nodePath := range h.eachNode() {
+		paths = append(paths, nodePath)
+	}
+	assert.ElementsMatch(t, []string{"", "github"}, paths)
+	assert.Equal(t, 2, h.NodeCount())
+}
+
+func TestGetToolsInCategoryIncludeSchema(t *testing.T) {
+	h := loadTestHierarchy(t)
+
+	t.Run("compact by default", func(t *testing.T) {
+		response, err := h.HandleGetToolsInCategory("everything")
+		require.NoError(t, err)
+
+		tools := response["tools"].(map[string]interface{})
+		echo := tools["echo"].(map[string]interface{})
+		assert.Equal(t, "everything.echo", echo["tool_path"])
+		assert.NotContains(t, echo, "inputSchema")
+	})
+
+	t.Run("schemas on demand", func(t *testing.T) {
+		response, err := h.HandleGetToolsInCategoryWithOptions("everything", CategoryOptions{IncludeSchema: true})
+		require.NoError(t, err)
+
+		tools := response["tools"].(map[string]interface{})
+		echo := tools["echo"].(map[string]interface{})
+		require.Contains(t, echo, "inputSchema")
+		schema := echo["inputSchema"].(map[string]interface{})
+		assert.Contains(t, schema["properties"], "message")
+
+		annotated := tools["annotatedMessage"].(map[string]interface{})
+		assert.Contains(t, annotated, "inputSchema")
+	})
+}
+
+func TestDescribeTool(t *testing.T) {
+	h := loadTestHierarchy(t)
+
+	response, err := h.HandleDescribeTool("everything.add")
+	require.NoError(t, err)
+	assert.Equal(t, "everything.add", response["tool_path"])
+	assert.Equal(t, "add", response["maps_to"])
+	assert.Equal(t, "everything", response["server"])
+	require.Contains(t, response, "inputSchema")
+	assert.Equal(t, []interface{}{"a", "b"}, response["inputSchema"].(map[string]interface{})["required"])
+
+	response, err = h.HandleDescribeTool("everything.add.add")
+	require.NoError(t, err)
+	assert.Equal(t, "everything.add", response["tool_path"], "aliases resolve to the canonical path")
+
+	_, err = h.HandleDescribeTool("everything.missing")
+	assert.Error(t, err)
+}
+
+func TestEffectiveTimeout(t *testing.T) {
+	serverCfg := &config.MCPClientConfigV2{
+		Options: &config.OptionsV2{ToolTimeout: config.Duration(time.Minute)},
+	}
+
+	timeout, source := effectiveTimeout(&ToolDefinition{TimeoutMs: 500}, serverCfg)
+	assert.Equal(t, 500*time.Millisecond, timeout)
+	assert.Equal(t, "tool timeout_ms", source)
+
+	timeout, source = effectiveTimeout(&ToolDefinition{}, serverCfg)
+	assert.Equal(t, time.Minute, timeout)
+	assert.Equal(t, "server toolTimeout", source)
+
+	timeout, source = effectiveTimeout(&ToolDefinition{}, nil)
+	assert.Equal(t, DefaultToolTimeout, timeout)
+	assert.Equal(t, "default", source)
+}
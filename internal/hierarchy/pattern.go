@@ -0,0 +1,40 @@
+package hierarchy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// compilePattern compiles a name or tool path pattern. Patterns are matched against the whole string:
+//   - "/expr/" is a regular expression, e.g. "/(get|list)_.*/"
+//   - anything else is a glob where "*" matches any run of characters (including dots) and "?" a
+//     single character; a pattern without wildcards is an exact name
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile("^(?:" + pattern[1:len(pattern)-1] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		return re, nil
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String()), nil
+}
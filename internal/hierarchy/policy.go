@@ -0,0 +1,141 @@
+package hierarchy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// AccessPolicy decides which tool paths a caller may see and execute
+// A nil policy allows everything.
+type AccessPolicy struct {
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+// NewAccessPolicy builds a policy from allow and deny path patterns such as "github.*", "filesystem.write_*"
+// or "/github\.(get|list)_.*/" (see compilePattern).
+// A tool is allowed when it matches no deny pattern and, if allow patterns are given, at least one of them.
+func NewAccessPolicy(allow, deny []string) (*AccessPolicy, error) {
+	policy := &AccessPolicy{}
+	for _, pattern := range allow {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		policy.allow = append(policy.allow, re)
+	}
+	for _, pattern := range deny {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		policy.deny = append(policy.deny, re)
+	}
+	return policy, nil
+}
+
+// Allows reports whether the tool at toolPath may be listed and executed
+func (p *AccessPolicy) Allows(toolPath string) bool {
+	if p == nil {
+		return true
+	}
+	for _, re := range p.deny {
+		if re.MatchString(toolPath) {
+			return false
+		}
+	}
+	if len(p.allow) == 0 {
+		return true
+	}
+	for _, re := range p.allow {
+		if re.MatchString(toolPath) {
+			return true
+		}
+	}
+	return false
+}
+
+type accessPolicyKey struct{}
+
+// WithAccessPolicy attaches the caller's policy to ctx; HandleExecuteTool enforces it
+func WithAccessPolicy(ctx context.Context, policy *AccessPolicy) context.Context {
+	return context.WithValue(ctx, accessPolicyKey{}, policy)
+}
+
+// AccessPolicyFromContext returns the caller's policy, or nil if none was attached
+func AccessPolicyFromContext(ctx context.Context) *AccessPolicy {
+	policy, _ := ctx.Value(accessPolicyKey{}).(*AccessPolicy)
+	return policy
+}
+
+// ErrAccessDenied is wrapped by the errors CheckAccess returns
+var ErrAccessDenied = errors.New("access denied")
+
+// CheckAccess returns an error if policy denies the tool at toolPath
+// The check runs against the canonical path of the tool, so aliases of a denied path are denied too.
+func (h *Hierarchy) CheckAccess(policy *AccessPolicy, toolPath string) error {
+	if policy == nil {
+		return nil
+	}
+	_, canonicalPath, err := h.resolveTool(toolPath)
+	if err != nil {
+		return err
+	}
+	if !policy.Allows(canonicalPath) {
+		return fmt.Errorf("%w: tool %s is not allowed for this caller", ErrAccessDenied, toolPath)
+	}
+	return nil
+}
+
+// CheckServerAccess returns an error if policy denies every tool of the server
+// Resources and prompts have no tool path of their own, so a caller may reach a server's
+// resources and prompts, and start it for them, only if it may execute one of its tools.
+func (h *Hierarchy) CheckServerAccess(policy *AccessPolicy, serverName string) error {
+	if policy == nil {
+		return nil
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if !h.serverAllowed(policy, serverName) {
+		return fmt.Errorf("%w: server %s is not allowed for this caller", ErrAccessDenied, serverName)
+	}
+	return nil
+}
+
+// serverAllowed reports whether policy allows any tool that runs on the server
+// Must be called with h.mu held.
+func (h *Hierarchy) serverAllowed(policy *AccessPolicy, serverName string) bool {
+	if policy == nil {
+		return true
+	}
+	for path, node := range h.eachNode() {
+		for toolName, toolDef := range node.Tools {
+			if toolDef.Server == serverName && policy.Allows(toolPathFor(path, toolName)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subtreeAllowed reports whether policy allows any tool at or below nodePath
+// Must be called with h.mu held.
+func (h *Hierarchy) subtreeAllowed(policy *AccessPolicy, nodePath string) bool {
+	if policy == nil {
+		return true
+	}
+	for path, node := range h.eachNode() {
+		if nodePath != "" && path != nodePath && !strings.HasPrefix(path, nodePath+".") {
+			continue
+		}
+		for toolName := range node.Tools {
+			if policy.Allows(toolPathFor(path, toolName)) {
+				return true
+			}
+		}
+	}
+	return false
+}
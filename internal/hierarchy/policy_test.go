@@ -0,0 +1,103 @@
+package hierarchy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var policyNodes = map[string]string{
+	"root.json":                  `{"overview": "Tools", "categories": {"github": "GitHub", "filesystem": "Files"}}`,
+	"github/github.json":         `{"mcp_server": {"name": "github", "command": "github-mcp"}}`,
+	"github/create_issue.json":   `{"tools": {"create_issue": {"description": "Create an issue"}}}`,
+	"filesystem/filesystem.json": `{"mcp_server": {"name": "filesystem", "command": "fs-mcp"}}`,
+	"filesystem/read_file.json":  `{"tools": {"read_file": {"description": "Read a file"}}}`,
+	"filesystem/write_file.json": `{"tools": {"write_file": {"description": "Write a file"}}}`,
+}
+
+func TestAccessPolicy(t *testing.T) {
+	policy, err := NewAccessPolicy([]string{"github.*", "filesystem.*"}, []string{"filesystem.write_*"})
+	require.NoError(t, err)
+
+	assert.True(t, policy.Allows("github.create_issue"))
+	assert.True(t, policy.Allows("github.issues.create_issue"), "* spans nested categories")
+	assert.True(t, policy.Allows("filesystem.read_file"))
+	assert.False(t, policy.Allows("filesystem.write_file"), "deny wins over allow")
+	assert.False(t, policy.Allows("slack.post_message"), "not in the allow list")
+
+	denyOnly, err := NewAccessPolicy(nil, []string{"github.delete_?epo"})
+	require.NoError(t, err)
+	assert.False(t, denyOnly.Allows("github.delete_repo"))
+	assert.True(t, denyOnly.Allows("slack.post_message"))
+
+	var unrestricted *AccessPolicy
+	assert.True(t, unrestricted.Allows("anything"))
+
+	_, err = NewAccessPolicy([]string{""}, nil)
+	assert.Error(t, err)
+}
+
+func TestGetToolsInCategoryHidesDeniedTools(t *testing.T) {
+	h := newTestHierarchy(t, policyNodes)
+	policy, err := NewAccessPolicy([]string{"filesystem.*"}, []string{"filesystem.write_*"})
+	require.NoError(t, err)
+	opts := CategoryOptions{Policy: policy}
+
+	root, err := h.HandleGetToolsInCategoryWithOptions("", opts)
+	require.NoError(t, err)
+	children := root["children"].(map[string]interface{})
+	assert.Contains(t, children, "filesystem")
+	assert.NotContains(t, children, "github", "branches without any allowed tool are hidden")
+
+	fs, err := h.HandleGetToolsInCategoryWithOptions("filesystem", opts)
+	require.NoError(t, err)
+	tools := fs["tools"].(map[string]interface{})
+	assert.Contains(t, tools, "read_file")
+	assert.NotContains(t, tools, "write_file")
+
+	_, err = h.HandleGetToolsInCategoryWithOptions("github", opts)
+	assert.ErrorContains(t, err, "category not found")
+
+	// Without a policy everything stays visible
+	fs, err = h.HandleGetToolsInCategory("filesystem")
+	require.NoError(t, err)
+	assert.Contains(t, fs["tools"], "write_file")
+}
+
+func TestExecuteToolEnforcesPolicy(t *testing.T) {
+	h := newTestHierarchy(t, policyNodes)
+	policy, err := NewAccessPolicy(nil, []string{"filesystem.write_file"})
+	require.NoError(t, err)
+	ctx := WithAccessPolicy(context.Background(), policy)
+
+	registry := NewServerRegistry(nil)
+	defer registry.Close()
+
+	_, err = h.HandleExecuteTool(ctx, registry, "filesystem.write_file", map[string]interface{}{})
+	assert.ErrorContains(t, err, "access denied")
+
+	// Aliases resolve to the same tool and are denied too
+	_, err = h.HandleExecuteTool(ctx, registry, "filesystem.write_file.write_file", map[string]interface{}{})
+	assert.ErrorContains(t, err, "access denied")
+
+	// Allowed tools get past the policy (and fail later, as no server can be started here)
+	_, err = h.HandleExecuteTool(ctx, registry, "filesystem.read_file", map[string]interface{}{})
+	assert.NotContains(t, err.Error(), "access denied")
+}
+
+func TestSearchToolsWithPolicy(t *testing.T) {
+	h := newTestHierarchy(t, policyNodes)
+	policy, err := NewAccessPolicy(nil, []string{"filesystem.write_*"})
+	require.NoError(t, err)
+
+	response, err := h.HandleSearchToolsWithPolicy("file", 10, policy)
+	require.NoError(t, err)
+
+	var paths []string
+	for _, result := range response["results"].([]map[string]interface{}) {
+		paths = append(paths, result["tool_path"].(string))
+	}
+	assert.Equal(t, []string{"filesystem.read_file"}, paths)
+}
@@ -0,0 +1,563 @@
+package hierarchy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/voicetreelab/lazy-mcp/internal/client"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// restartPolicy bounds how often a failing server is re-spawned
+type restartPolicy struct {
+	// baseBackoff is the wait after the second consecutive failure, doubling up to maxBackoff.
+	// The first failure is retried on the next call so a one-off crash is invisible to agents.
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	// After breakerThreshold consecutive failures the circuit opens and calls fail fast for breakerCooldown
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	// pingFailureThreshold consecutive failed pings mark a client as dead
+	pingFailureThreshold int
+	// timeoutThreshold consecutive timed out calls mark a client as hung
+	timeoutThreshold int
+}
+
+const (
+	// defaultIdleCheckInterval is how often running clients are checked against their idleTimeout
+	defaultIdleCheckInterval = 15 * time.Second
+
+	// defaultStartTimeout bounds the initialize handshake of a newly started server
+	defaultStartTimeout = 2 * time.Minute
+)
+
+var defaultRestartPolicy = restartPolicy{
+	baseBackoff:          time.Second,
+	maxBackoff:           30 * time.Second,
+	breakerThreshold:     5,
+	breakerCooldown:      2 * time.Minute,
+	pingFailureThreshold: 3,
+	timeoutThreshold:     3,
+}
+
+// serverEntry is a running client together with the cancel func of its background tasks
+type serverEntry struct {
+	client *client.Client
+	stop   context.CancelFunc
+	// idleTimeout is zero when the server is never shut down for inactivity
+	idleTimeout time.Duration
+	// lastUsed (unix nanoseconds) and inFlight are updated without holding the registry lock
+	lastUsed atomic.Int64
+	inFlight atomic.Int32
+	// timeouts counts consecutive calls that timed out, reset by a call that got an answer
+	timeouts atomic.Int32
+}
+
+func (e *serverEntry) touch() {
+	e.lastUsed.Store(time.Now().UnixNano())
+}
+
+// idleFor returns how long the client has been unused, or zero while a call is in flight
+func (e *serverEntry) idleFor(now time.Time) time.Duration {
+	if e.inFlight.Load() > 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(0, e.lastUsed.Load()))
+}
+
+// serverHealth tracks consecutive failures of a server across restarts
+type serverHealth struct {
+	failures int
+	retryAt  time.Time
+	lastErr  error
+}
+
+// RegistryObserver is told about server lifecycle events, e.g. to export metrics
+// Its methods are called from the goroutine of the event and must not block.
+type RegistryObserver interface {
+	// ServerStarted reports a cold start that took the given time, or failed with err
+	ServerStarted(serverName string, took time.Duration, err error)
+	// PingFailed reports a failed health check ping of a running server
+	PingFailed(serverName string)
+}
+
+// ServerRegistry manages MCP client connections
+type ServerRegistry struct {
+	servers       map[string]*serverEntry
+	health        map[string]*serverHealth
+	serverConfigs map[string]*config.MCPClientConfigV2
+	policy        restartPolicy
+	newClient     func(name string, cfg *config.MCPClientConfigV2) (*client.Client, error)
+	// starts deduplicates concurrent startups of the same server
+	starts       singleflight.Group
+	startTimeout time.Duration
+	// idleCheckInterval is the tick of the idle reaper, started with the first client that has an idleTimeout
+	idleCheckInterval time.Duration
+	reaperOnce        sync.Once
+	observer          RegistryObserver
+	// ctx lives as long as the registry and parents the connection and ping tasks of every client
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.RWMutex
+}
+
+// NewServerRegistry creates a new server registry with server configurations
+func NewServerRegistry(serverConfigs map[string]*config.MCPClientConfigV2) *ServerRegistry {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ServerRegistry{
+		servers:       make(map[string]*serverEntry),
+		health:        make(map[string]*serverHealth),
+		serverConfigs: serverConfigs,
+		policy:        defaultRestartPolicy,
+		newClient:     client.NewMCPClient,
+		ctx:           ctx,
+		cancel:        cancel,
+
+		startTimeout:      defaultStartTimeout,
+		idleCheckInterval: defaultIdleCheckInterval,
+	}
+}
+
+// SetObserver registers the observer of server startups and pings
+// Must be called before any server is started, including by Preload
+func (r *ServerRegistry) SetObserver(observer RegistryObserver) {
+	r.observer = observer
+}
+
+// RunningCount returns the number of servers with a running client
+func (r *ServerRegistry) RunningCount() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.servers)
+}
+
+// ServerConfig returns the configuration of a server known to the registry
+func (r *ServerRegistry) ServerConfig(serverName string) (*config.MCPClientConfigV2, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cfg, ok := r.serverConfigs[serverName]
+	return cfg, ok
+}
+
+// SetServerConfigs replaces the known server configurations, e.g. after a hierarchy reload
+// Clients that are already running keep their current connection.
+// Returns the names of the servers that are new or whose configuration changed.
+func (r *ServerRegistry) SetServerConfigs(serverConfigs map[string]*config.MCPClientConfigV2) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var changed []string
+	for name, cfg := range serverConfigs {
+		if previous, ok := r.serverConfigs[name]; !ok || !reflect.DeepEqual(previous, cfg) {
+			changed = append(changed, name)
+		}
+	}
+	r.serverConfigs = serverConfigs
+	return changed
+}
+
+// GetOrLoadServer gets an existing client or creates and initializes a new one
+// This implements lazy loading - servers are only started when first accessed.
+// A client that was evicted after a crash or closed for inactivity is transparently
+// re-spawned here, subject to exponential backoff and a circuit breaker.
+//
+// Startups are deduplicated per server: concurrent callers for the same server share
+// one in-flight initialization, while callers for other servers are never blocked by it.
+// A caller whose ctx ends stops waiting, but the shared startup carries on for the others.
+func (r *ServerRegistry) GetOrLoadServer(ctx context.Context, serverName string) (*client.Client, error) {
+	ctx, span := tracing.Start(ctx, "ServerRegistry.GetOrLoadServer", trace.SpanKindInternal, attribute.String("mcp.server", serverName))
+	defer span.End()
+
+	if entry := r.runningEntry(serverName); entry != nil {
+		span.SetAttributes(attribute.Bool("mcp.cold_start", false))
+		return entry.client, nil
+	}
+	span.SetAttributes(attribute.Bool("mcp.cold_start", true))
+
+	// The startup is traced as part of the call that triggered it
+	startup := r.starts.DoChan(serverName, func() (interface{}, error) {
+		return r.loadServer(ctx, serverName)
+	})
+
+	select {
+	case res := <-startup:
+		if res.Err != nil {
+			tracing.RecordError(span, res.Err)
+			return nil, res.Err
+		}
+		return res.Val.(*client.Client), nil
+	case <-ctx.Done():
+		err := fmt.Errorf("gave up waiting for server %s to start: %w", serverName, ctx.Err())
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+}
+
+// runningEntry returns the registered entry of a server, marking it as used, or nil if it is not running
+func (r *ServerRegistry) runningEntry(serverName string) *serverEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, exists := r.servers[serverName]
+	if !exists {
+		return nil
+	}
+	entry.touch()
+	return entry
+}
+
+// loadServer starts a server and registers its client
+// It runs at most once at a time per server and does not hold r.mu while the server starts.
+// traceCtx only carries the span of the caller; the client runs on a registry-owned context.
+func (r *ServerRegistry) loadServer(traceCtx context.Context, serverName string) (*client.Client, error) {
+	r.mu.Lock()
+	// Check again in case a startup finished since the caller looked
+	if entry, exists := r.servers[serverName]; exists {
+		entry.touch()
+		r.mu.Unlock()
+		return entry.client, nil
+	}
+
+	// Look up the server config
+	cfg, exists := r.serverConfigs[serverName]
+	if !exists {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("server config not found: %s", serverName)
+	}
+
+	if err := r.checkRestartAllowed(serverName); err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	r.mu.Unlock()
+
+	// The client outlives the request that triggered its startup, so it runs on a registry-owned context
+	clientCtx, stop := context.WithCancel(r.ctx)
+	started := time.Now()
+	mcpClient, err := r.startClient(clientCtx, traceCtx, serverName, cfg)
+	if r.observer != nil {
+		r.observer.ServerStarted(serverName, time.Since(started), err)
+	}
+	if err != nil {
+		stop()
+		r.mu.Lock()
+		r.recordFailure(serverName, err)
+		r.mu.Unlock()
+		return nil, err
+	}
+
+	r.mu.Lock()
+	if r.ctx.Err() != nil {
+		r.mu.Unlock()
+		stop()
+		_ = mcpClient.Close()
+		return nil, fmt.Errorf("server registry closed while starting %s", serverName)
+	}
+
+	// Store the client
+	entry := &serverEntry{client: mcpClient, stop: stop}
+	if cfg.Options != nil && !cfg.Options.KeepAlive.OrElse(false) {
+		entry.idleTimeout = cfg.Options.IdleTimeout.Duration()
+	}
+	entry.touch()
+	r.servers[serverName] = entry
+	r.mu.Unlock()
+
+	log.Printf("Created and initialized MCP client for server: %s", serverName)
+	r.watchClient(clientCtx, serverName, mcpClient)
+
+	if entry.idleTimeout > 0 {
+		r.reaperOnce.Do(func() {
+			go r.reapIdleClients(r.idleCheckInterval)
+		})
+	}
+
+	return mcpClient, nil
+}
+
+// startClient spawns, starts and initializes a client for the given server config
+// ctx bounds the lifetime of the client's connection; the initialize handshake is limited to startTimeout
+// and traced under the span in traceCtx.
+func (r *ServerRegistry) startClient(ctx, traceCtx context.Context, serverName string, cfg *config.MCPClientConfigV2) (*client.Client, error) {
+	// Create the MCP client
+	mcpClient, err := r.newClient(serverName, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MCP client: %w", err)
+	}
+
+	// Start the client if needed
+	if mcpClient.NeedManualStart() {
+		err := mcpClient.GetClient().Start(ctx)
+		if err != nil {
+			_ = mcpClient.Close()
+			return nil, fmt.Errorf("failed to start MCP client: %w", err)
+		}
+	}
+
+	// Initialize the client
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = mcp.Implementation{Name: "mcp-proxy-recursive"}
+	initRequest.Params.Capabilities = mcp.ClientCapabilities{}
+
+	initCtx, cancel := context.WithTimeout(tracing.Link(ctx, traceCtx), r.startTimeout)
+	defer cancel()
+	initCtx, span := tracing.Start(initCtx, "Initialize", trace.SpanKindClient, attribute.String("mcp.server", serverName))
+	defer span.End()
+
+	_, err = mcpClient.GetClient().Initialize(initCtx, initRequest)
+	if err != nil {
+		tracing.RecordError(span, err)
+		_ = mcpClient.Close()
+		return nil, fmt.Errorf("failed to initialize MCP client: %w", err)
+	}
+
+	return mcpClient, nil
+}
+
+// Preload starts every server whose options set preload, in the background
+// Servers that are already running are left alone. A failed preload is only logged;
+// the server is retried lazily on its next execute_tool call.
+func (r *ServerRegistry) Preload() {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.serverConfigs))
+	for name := range r.serverConfigs {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+
+	r.PreloadServers(names)
+}
+
+// PreloadServers starts the named servers whose options set preload, like Preload
+// After a hierarchy reload only the servers SetServerConfigs reports as new or changed are
+// preloaded, so a server closed for inactivity is not restarted by every reload.
+func (r *ServerRegistry) PreloadServers(serverNames []string) {
+	r.mu.RLock()
+	var names []string
+	for _, name := range serverNames {
+		if cfg, ok := r.serverConfigs[name]; ok && cfg.Options != nil && cfg.Options.Preload.OrElse(false) {
+			names = append(names, name)
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, name := range names {
+		go func(serverName string) {
+			log.Printf("Preloading MCP server: %s", serverName)
+			if _, err := r.GetOrLoadServer(r.ctx, serverName); err != nil {
+				log.Printf("Warning: failed to preload MCP server %s, it will be started on first use: %v", serverName, err)
+			}
+		}(name)
+	}
+}
+
+// TrackCall marks a call on mcpClient as in flight so the client is not closed for
+// inactivity while it runs. The returned func ends the call and must always be called.
+func (r *ServerRegistry) TrackCall(serverName string, mcpClient *client.Client) func() {
+	r.mu.RLock()
+	entry, exists := r.servers[serverName]
+	r.mu.RUnlock()
+	if !exists || entry.client != mcpClient {
+		return func() {}
+	}
+
+	entry.inFlight.Add(1)
+	entry.touch()
+	return func() {
+		entry.touch()
+		entry.inFlight.Add(-1)
+	}
+}
+
+// reapIdleClients periodically closes clients that have been unused for longer than their idleTimeout
+func (r *ServerRegistry) reapIdleClients(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.closeIdleClients(now)
+		}
+	}
+}
+
+// closeIdleClients closes every client idle for longer than its idleTimeout as of now
+// Idle shutdown is not a failure, so the next call restarts the server without any backoff.
+func (r *ServerRegistry) closeIdleClients(now time.Time) {
+	r.mu.Lock()
+	idle := make(map[string]*serverEntry)
+	for name, entry := range r.servers {
+		if entry.idleTimeout > 0 && entry.idleFor(now) > entry.idleTimeout {
+			idle[name] = entry
+			delete(r.servers, name)
+		}
+	}
+	r.mu.Unlock()
+
+	for name, entry := range idle {
+		log.Printf("Closing idle MCP client %s (unused for more than %s), it will be restarted on next use", name, entry.idleTimeout)
+		entry.stop()
+		_ = entry.client.Close()
+	}
+}
+
+// watchClient evicts a client when its connection is lost, its process exits or it stops answering pings
+func (r *ServerRegistry) watchClient(ctx context.Context, serverName string, mcpClient *client.Client) {
+	mcpClient.GetClient().OnConnectionLost(func(err error) {
+		r.evict(serverName, mcpClient, fmt.Errorf("connection lost: %w", err))
+	})
+
+	// stdio servers have no connection to lose; a crash would only show on the next call
+	mcpClient.WatchProcess(func(err error) {
+		r.evict(serverName, mcpClient, fmt.Errorf("server process exited: %w", err))
+	})
+
+	// Start ping task if needed
+	if mcpClient.NeedPing() {
+		threshold := r.policy.pingFailureThreshold
+		mcpClient.SetPingFailureHandler(func(failCount int, err error) {
+			if r.observer != nil {
+				r.observer.PingFailed(serverName)
+			}
+			if failCount >= threshold {
+				r.evict(serverName, mcpClient, fmt.Errorf("%d consecutive ping failures: %w", failCount, err))
+			}
+		})
+		go mcpClient.StartPingTask(ctx)
+	}
+}
+
+// ReportSuccess records a successful call, resetting the server's failure and timeout counts
+func (r *ServerRegistry) ReportSuccess(serverName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.health, serverName)
+	if entry, exists := r.servers[serverName]; exists {
+		entry.timeouts.Store(0)
+	}
+}
+
+// ReportFailure inspects an error returned by a call on mcpClient.
+// Transport-level errors (dead child process, broken stream) evict the client so the
+// next call re-spawns it; errors returned by the tool itself leave the client in place.
+// A canceled call says nothing about the server's health, and neither does a single slow
+// tool: mcp-go wraps both in transport.Error too, but the client is only evicted once
+// timeoutThreshold calls in a row have timed out, as a hung server never answers again.
+func (r *ServerRegistry) ReportFailure(serverName string, mcpClient *client.Client, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		r.mu.RLock()
+		entry, exists := r.servers[serverName]
+		r.mu.RUnlock()
+		if !exists || entry.client != mcpClient {
+			return
+		}
+		if timeouts := int(entry.timeouts.Add(1)); timeouts >= r.policy.timeoutThreshold {
+			r.evict(serverName, mcpClient, fmt.Errorf("%d consecutive calls timed out: %w", timeouts, err))
+		}
+		return
+	}
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) {
+		r.evict(serverName, mcpClient, err)
+	}
+}
+
+// evict removes a dead client from the registry and closes it in the background
+// It is a no-op if mcpClient is no longer the registered client for serverName
+func (r *ServerRegistry) evict(serverName string, mcpClient *client.Client, reason error) {
+	r.mu.Lock()
+	entry, exists := r.servers[serverName]
+	if !exists || entry.client != mcpClient {
+		r.mu.Unlock()
+		return
+	}
+	delete(r.servers, serverName)
+	r.recordFailure(serverName, reason)
+	r.mu.Unlock()
+
+	log.Printf("Evicting MCP client %s, it will be restarted on next use: %v", serverName, reason)
+	entry.stop()
+	go func() {
+		_ = mcpClient.Close()
+	}()
+}
+
+// recordFailure bumps the failure count and schedules the next allowed restart
+// Must be called with r.mu held
+func (r *ServerRegistry) recordFailure(serverName string, err error) {
+	health, ok := r.health[serverName]
+	if !ok {
+		health = &serverHealth{}
+		r.health[serverName] = health
+	}
+	health.failures++
+	health.lastErr = err
+	health.retryAt = time.Now().Add(r.policy.delayAfter(health.failures))
+}
+
+// checkRestartAllowed fails fast while a server is backing off or its circuit is open
+// Must be called with r.mu held
+func (r *ServerRegistry) checkRestartAllowed(serverName string) error {
+	health, ok := r.health[serverName]
+	if !ok {
+		return nil
+	}
+	wait := time.Until(health.retryAt)
+	if wait <= 0 {
+		return nil // Half-open: let this call try again
+	}
+	state := "backing off"
+	if health.failures >= r.policy.breakerThreshold {
+		state = "circuit open"
+	}
+	return fmt.Errorf("server %s is unavailable (%s after %d consecutive failures, next attempt in %s): %w",
+		serverName, state, health.failures, wait.Round(time.Second), health.lastErr)
+}
+
+// delayAfter returns how long to wait before restarting after the given number of consecutive failures
+func (p restartPolicy) delayAfter(failures int) time.Duration {
+	if failures >= p.breakerThreshold {
+		return p.breakerCooldown
+	}
+	if failures <= 1 {
+		return 0
+	}
+	delay := p.baseBackoff << (failures - 2)
+	if delay > p.maxBackoff || delay <= 0 {
+		delay = p.maxBackoff
+	}
+	return delay
+}
+
+// Close closes all clients in the registry
+func (r *ServerRegistry) Close() {
+	r.cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name, entry := range r.servers {
+		log.Printf("Closing MCP client: %s", name)
+		entry.stop()
+		_ = entry.client.Close()
+	}
+	r.servers = make(map[string]*serverEntry)
+}
@@ -0,0 +1,579 @@
+package hierarchy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TBXark/optional-go"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/client"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+)
+
+// flakyTransport is an in-process transport that can be switched into a broken state
+// to simulate a crashed child process or a dropped stream
+type flakyTransport struct {
+	*transport.InProcessTransport
+	broken *atomic.Bool
+	// hung requests get no answer until their ctx ends, like a stuck child process
+	hung *atomic.Bool
+	// noTemplates answers resources/templates/list with "method not found", like servers without templates
+	noTemplates *atomic.Bool
+}
+
+func (t *flakyTransport) SendRequest(ctx context.Context, request transport.JSONRPCRequest) (*transport.JSONRPCResponse, error) {
+	if t.hung.Load() {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if t.broken.Load() {
+		return nil, errors.New("broken pipe")
+	}
+	if t.noTemplates.Load() && request.Method == string(mcp.MethodResourcesTemplatesList) {
+		response := &transport.JSONRPCResponse{JSONRPC: mcp.JSONRPC_VERSION, ID: request.ID}
+		response.Error = &struct {
+			Code    int             `json:"code"`
+			Message string          `json:"message"`
+			Data    json.RawMessage `json:"data"`
+		}{Code: mcp.METHOD_NOT_FOUND, Message: "Method not found"}
+		return response, nil
+	}
+	return t.InProcessTransport.SendRequest(ctx, request)
+}
+
+// fakeBackend is an in-process MCP server with an echo tool, served through flaky transports
+type fakeBackend struct {
+	server *server.MCPServer
+	broken atomic.Bool
+	hung   atomic.Bool
+	// noTemplates makes the server reject resources/templates/list
+	noTemplates atomic.Bool
+	starts      atomic.Int32
+	// startErr, when set, makes new clients fail to be created
+	startErr atomic.Pointer[error]
+	// gates hold back the startup of the named servers until the channel is closed
+	gates map[string]chan struct{}
+}
+
+func newFakeBackend() *fakeBackend {
+	b := &fakeBackend{server: server.NewMCPServer("fake", "1.0.0")}
+	b.server.AddTool(mcp.NewTool("echo", mcp.WithString("message")), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(request.GetString("message", "")), nil
+	})
+	b.server.AddPrompt(mcp.NewPrompt("greet", mcp.WithArgument("name", mcp.RequiredArgument())), func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		return mcp.NewGetPromptResult("Greeting", []mcp.PromptMessage{
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent("Hello, "+request.Params.Arguments["name"])),
+		}), nil
+	})
+	b.server.AddResource(mcp.NewResource("file:///readme.md", "readme", mcp.WithMIMEType("text/markdown")), func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{URI: request.Params.URI, MIMEType: "text/markdown", Text: "# Fake"},
+		}, nil
+	})
+	return b
+}
+
+func (b *fakeBackend) newClient(name string, cfg *config.MCPClientConfigV2) (*client.Client, error) {
+	b.starts.Add(1)
+	if gate, ok := b.gates[name]; ok {
+		<-gate
+	}
+	if errPtr := b.startErr.Load(); errPtr != nil {
+		return nil, *errPtr
+	}
+	t := &flakyTransport{InProcessTransport: transport.NewInProcessTransport(b.server), broken: &b.broken, hung: &b.hung, noTemplates: &b.noTemplates}
+	return client.WrapMCPClient(name, mcpclient.NewClient(t), cfg.Options), nil
+}
+
+func newTestRegistry(b *fakeBackend) *ServerRegistry {
+	registry := NewServerRegistry(map[string]*config.MCPClientConfigV2{
+		"fake": {Options: &config.OptionsV2{}},
+	})
+	registry.newClient = b.newClient
+	return registry
+}
+
+func callEcho(ctx context.Context, registry *ServerRegistry) error {
+	c, err := registry.GetOrLoadServer(ctx, "fake")
+	if err != nil {
+		return err
+	}
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "echo"
+	request.Params.Arguments = map[string]interface{}{"message": "hi"}
+	_, err = c.GetClient().CallTool(ctx, request)
+	if err != nil {
+		registry.ReportFailure("fake", c, err)
+		return err
+	}
+	registry.ReportSuccess("fake")
+	return nil
+}
+
+func TestRegistryRestartsDeadClient(t *testing.T) {
+	ctx := context.Background()
+	backend := newFakeBackend()
+	registry := newTestRegistry(backend)
+	defer registry.Close()
+
+	require.NoError(t, callEcho(ctx, registry))
+	assert.Equal(t, int32(1), backend.starts.Load())
+
+	// The child dies: the failing call evicts the client
+	backend.broken.Store(true)
+	require.Error(t, callEcho(ctx, registry))
+
+	// Next call transparently re-spawns it
+	backend.broken.Store(false)
+	require.NoError(t, callEcho(ctx, registry))
+	assert.Equal(t, int32(2), backend.starts.Load())
+}
+
+func TestRegistryKeepsClientOnToolError(t *testing.T) {
+	ctx := context.Background()
+	backend := newFakeBackend()
+	registry := newTestRegistry(backend)
+	defer registry.Close()
+
+	c, err := registry.GetOrLoadServer(ctx, "fake")
+	require.NoError(t, err)
+
+	registry.ReportFailure("fake", c, errors.New("tool not found: nope"))
+
+	again, err := registry.GetOrLoadServer(ctx, "fake")
+	require.NoError(t, err)
+	assert.Same(t, c, again)
+}
+
+func TestRegistryKeepsClientOnTimeout(t *testing.T) {
+	ctx := context.Background()
+	backend := newFakeBackend()
+	registry := newTestRegistry(backend)
+	registry.policy.breakerThreshold = 1
+	defer registry.Close()
+
+	c, err := registry.GetOrLoadServer(ctx, "fake")
+	require.NoError(t, err)
+
+	// mcp-go wraps the deadline in a transport.Error, like a broken pipe
+	backend.hung.Store(true)
+	for i := 0; i < 2; i++ {
+		callCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		err := callEcho(callCtx, registry)
+		cancel()
+		var transportErr *transport.Error
+		require.ErrorAs(t, err, &transportErr)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+	backend.hung.Store(false)
+
+	again, err := registry.GetOrLoadServer(ctx, "fake")
+	require.NoError(t, err)
+	assert.Same(t, c, again, "a slow tool does not kill its server")
+	assert.NotContains(t, registry.health, "fake", "timeouts do not count toward the circuit breaker")
+	assert.Equal(t, int32(1), backend.starts.Load())
+}
+
+func TestRegistryEvictsHungClient(t *testing.T) {
+	ctx := context.Background()
+	backend := newFakeBackend()
+	registry := newTestRegistry(backend)
+	defer registry.Close()
+
+	timeOut := func(times int) {
+		backend.hung.Store(true)
+		defer backend.hung.Store(false)
+		for i := 0; i < times; i++ {
+			callCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+			require.ErrorIs(t, callEcho(callCtx, registry), context.DeadlineExceeded)
+			cancel()
+		}
+	}
+
+	require.NoError(t, callEcho(ctx, registry))
+
+	// An answered call in between resets the count
+	timeOut(2)
+	require.NoError(t, callEcho(ctx, registry))
+	timeOut(2)
+	require.NoError(t, callEcho(ctx, registry))
+	assert.Equal(t, int32(1), backend.starts.Load())
+
+	timeOut(defaultRestartPolicy.timeoutThreshold)
+	require.NoError(t, callEcho(ctx, registry))
+	assert.Equal(t, int32(2), backend.starts.Load(), "a server that keeps timing out is restarted")
+}
+
+// TestStdioServerProcess is the stdio MCP server of TestRegistryRestartsExitedStdioServer,
+// run in a child process of the test binary
+func TestStdioServerProcess(t *testing.T) {
+	if os.Getenv("LAZY_MCP_TEST_STDIO_SERVER") != "1" {
+		t.Skip("only runs as a child process")
+	}
+	backend := newFakeBackend()
+	backend.server.AddTool(mcp.NewTool("crash"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		os.Exit(3)
+		return nil, nil
+	})
+	_ = server.ServeStdio(backend.server)
+	os.Exit(0)
+}
+
+func TestRegistryRestartsExitedStdioServer(t *testing.T) {
+	ctx := context.Background()
+	registry := NewServerRegistry(map[string]*config.MCPClientConfigV2{
+		"stdio": {
+			TransportType: config.MCPClientTypeStdio,
+			Command:       os.Args[0],
+			Args:          []string{"-test.run=^TestStdioServerProcess$"},
+			Env:           map[string]string{"LAZY_MCP_TEST_STDIO_SERVER": "1"},
+			Options:       &config.OptionsV2{},
+		},
+	})
+	defer registry.Close()
+
+	c, err := registry.GetOrLoadServer(ctx, "stdio")
+	require.NoError(t, err)
+
+	// The process exits without answering; nothing reports the failure but its exit
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "crash"
+	callCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	go func() { _, _ = c.GetClient().CallTool(callCtx, request) }()
+	require.Eventually(t, func() bool { return registry.RunningCount() == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	again, err := registry.GetOrLoadServer(ctx, "stdio")
+	require.NoError(t, err)
+	assert.NotSame(t, c, again)
+
+	request.Params.Name = "echo"
+	request.Params.Arguments = map[string]interface{}{"message": "hi"}
+	result, err := again.GetClient().CallTool(ctx, request)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", result.Content[0].(mcp.TextContent).Text)
+}
+
+func TestRegistryBackoffAndCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	backend := newFakeBackend()
+	registry := newTestRegistry(backend)
+	registry.policy = restartPolicy{
+		baseBackoff:      time.Hour,
+		maxBackoff:       time.Hour,
+		breakerThreshold: 3,
+		breakerCooldown:  2 * time.Hour,
+	}
+	defer registry.Close()
+
+	startErr := errors.New("command not found")
+	backend.startErr.Store(&startErr)
+
+	// First failure is retried immediately
+	_, err := registry.GetOrLoadServer(ctx, "fake")
+	require.ErrorIs(t, err, startErr)
+	_, err = registry.GetOrLoadServer(ctx, "fake")
+	require.ErrorIs(t, err, startErr)
+	assert.Equal(t, int32(2), backend.starts.Load())
+
+	// Second failure backs off: calls fail fast without spawning
+	_, err = registry.GetOrLoadServer(ctx, "fake")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "backing off")
+	assert.Equal(t, int32(2), backend.starts.Load())
+
+	// Reaching the threshold opens the circuit
+	registry.health["fake"].retryAt = time.Time{}
+	_, err = registry.GetOrLoadServer(ctx, "fake")
+	require.ErrorIs(t, err, startErr)
+	_, err = registry.GetOrLoadServer(ctx, "fake")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "circuit open")
+
+	// Half-open after the cooldown: a successful start closes the circuit
+	backend.startErr.Store(nil)
+	registry.health["fake"].retryAt = time.Time{}
+	require.NoError(t, callEcho(ctx, registry))
+	assert.NotContains(t, registry.health, "fake")
+}
+
+func TestRestartPolicyDelay(t *testing.T) {
+	p := restartPolicy{baseBackoff: time.Second, maxBackoff: 10 * time.Second, breakerThreshold: 6, breakerCooldown: time.Minute}
+
+	assert.Equal(t, time.Duration(0), p.delayAfter(1))
+	assert.Equal(t, time.Second, p.delayAfter(2))
+	assert.Equal(t, 2*time.Second, p.delayAfter(3))
+	assert.Equal(t, 8*time.Second, p.delayAfter(5))
+	assert.Equal(t, time.Minute, p.delayAfter(6))
+}
+
+func TestRegistryClosesIdleClients(t *testing.T) {
+	ctx := context.Background()
+	backend := newFakeBackend()
+	registry := NewServerRegistry(map[string]*config.MCPClientConfigV2{
+		"fake":   {Options: &config.OptionsV2{IdleTimeout: config.Duration(time.Minute)}},
+		"pinned": {Options: &config.OptionsV2{IdleTimeout: config.Duration(time.Minute), KeepAlive: optional.NewField(true)}},
+	})
+	registry.newClient = backend.newClient
+	registry.idleCheckInterval = time.Hour // Drive closeIdleClients by hand
+	defer registry.Close()
+
+	require.NoError(t, callEcho(ctx, registry))
+	pinned, err := registry.GetOrLoadServer(ctx, "pinned")
+	require.NoError(t, err)
+
+	// Not idle long enough yet
+	registry.closeIdleClients(time.Now().Add(30 * time.Second))
+	assert.Contains(t, registry.servers, "fake")
+
+	// In-flight calls keep the client alive however long they run
+	c, err := registry.GetOrLoadServer(ctx, "fake")
+	require.NoError(t, err)
+	done := registry.TrackCall("fake", c)
+	registry.closeIdleClients(time.Now().Add(2 * time.Minute))
+	assert.Contains(t, registry.servers, "fake")
+	done()
+
+	registry.closeIdleClients(time.Now().Add(2 * time.Minute))
+	assert.NotContains(t, registry.servers, "fake")
+	assert.Contains(t, registry.servers, "pinned", "keepAlive servers are never closed for inactivity")
+
+	// The next call re-loads the server without any backoff
+	require.NoError(t, callEcho(ctx, registry))
+	assert.Equal(t, int32(3), backend.starts.Load())
+	assert.NotContains(t, registry.health, "fake")
+
+	again, err := registry.GetOrLoadServer(ctx, "pinned")
+	require.NoError(t, err)
+	assert.Same(t, pinned, again)
+}
+
+func newConcurrentRegistry(b *fakeBackend, names ...string) *ServerRegistry {
+	configs := make(map[string]*config.MCPClientConfigV2)
+	for _, name := range names {
+		configs[name] = &config.MCPClientConfigV2{Options: &config.OptionsV2{}}
+	}
+	registry := NewServerRegistry(configs)
+	registry.newClient = b.newClient
+	return registry
+}
+
+func TestRegistrySharesConcurrentStartup(t *testing.T) {
+	backend := newFakeBackend()
+	gate := make(chan struct{})
+	backend.gates = map[string]chan struct{}{"slow": gate}
+	registry := newConcurrentRegistry(backend, "slow")
+	defer registry.Close()
+
+	const callers = 10
+	clients := make(chan *client.Client, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := registry.GetOrLoadServer(context.Background(), "slow")
+			assert.NoError(t, err)
+			clients <- c
+		}()
+	}
+
+	// Give every caller time to join the in-flight startup before letting it finish
+	time.Sleep(50 * time.Millisecond)
+	close(gate)
+	wg.Wait()
+	close(clients)
+
+	first := <-clients
+	require.NotNil(t, first)
+	for c := range clients {
+		assert.Same(t, first, c)
+	}
+	assert.Equal(t, int32(1), backend.starts.Load())
+}
+
+func TestRegistrySlowStartupDoesNotBlockOtherServers(t *testing.T) {
+	backend := newFakeBackend()
+	gate := make(chan struct{})
+	defer close(gate)
+	backend.gates = map[string]chan struct{}{"slow": gate}
+	registry := newConcurrentRegistry(backend, "slow", "running", "cold")
+	defer registry.Close()
+
+	_, err := registry.GetOrLoadServer(context.Background(), "running")
+	require.NoError(t, err)
+
+	go func() {
+		_, _ = registry.GetOrLoadServer(context.Background(), "slow")
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err = registry.GetOrLoadServer(ctx, "running")
+	require.NoError(t, err, "an already running server must not wait for another server's startup")
+	_, err = registry.GetOrLoadServer(ctx, "cold")
+	require.NoError(t, err, "starting another server must not wait for a slow startup")
+
+	// A waiting caller can give up without cancelling the shared startup
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer waitCancel()
+	_, err = registry.GetOrLoadServer(waitCtx, "slow")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRegistryDoesNotCacheFailedStartup(t *testing.T) {
+	backend := newFakeBackend()
+	gate := make(chan struct{})
+	backend.gates = map[string]chan struct{}{"fake": gate}
+	registry := newConcurrentRegistry(backend, "fake")
+	defer registry.Close()
+
+	startErr := errors.New("command not found")
+	backend.startErr.Store(&startErr)
+
+	const callers = 5
+	var wg sync.WaitGroup
+	var failed atomic.Int32
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := registry.GetOrLoadServer(context.Background(), "fake"); errors.Is(err, startErr) {
+				failed.Add(1)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(gate)
+	wg.Wait()
+
+	assert.Equal(t, int32(callers), failed.Load(), "every waiting caller sees the failed startup")
+	assert.Equal(t, int32(1), backend.starts.Load())
+
+	// The failure is not cached: the next call starts the server again
+	backend.startErr.Store(nil)
+	_, err := registry.GetOrLoadServer(context.Background(), "fake")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), backend.starts.Load())
+}
+
+func TestRegistryPreload(t *testing.T) {
+	backend := newFakeBackend()
+	registry := NewServerRegistry(map[string]*config.MCPClientConfigV2{
+		"warm":   {Options: &config.OptionsV2{Preload: optional.NewField(true)}},
+		"broken": {Options: &config.OptionsV2{Preload: optional.NewField(true)}},
+		"lazy":   {Options: &config.OptionsV2{}},
+	})
+	defer registry.Close()
+
+	startErr := errors.New("command not found")
+	var brokenStarts atomic.Int32
+	registry.newClient = func(name string, cfg *config.MCPClientConfigV2) (*client.Client, error) {
+		if name == "broken" && brokenStarts.Add(1) == 1 {
+			return nil, startErr
+		}
+		return backend.newClient(name, cfg)
+	}
+
+	registry.Preload()
+
+	require.Eventually(t, func() bool {
+		registry.mu.RLock()
+		_, failed := registry.health["broken"]
+		registry.mu.RUnlock()
+		return registry.runningEntry("warm") != nil && failed
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Nil(t, registry.runningEntry("lazy"), "servers without preload stay lazy")
+
+	// A failed preload is retried on first use
+	_, err := registry.GetOrLoadServer(context.Background(), "broken")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), brokenStarts.Load())
+}
+
+func TestRegistryPreloadsOnlyChangedServersAfterReload(t *testing.T) {
+	backend := newFakeBackend()
+	idle := &config.OptionsV2{Preload: optional.NewField(true), IdleTimeout: config.Duration(time.Minute)}
+	registry := NewServerRegistry(map[string]*config.MCPClientConfigV2{
+		"fake": {Options: idle},
+	})
+	defer registry.Close()
+	registry.idleCheckInterval = time.Hour // Drive closeIdleClients by hand
+	registry.newClient = backend.newClient
+
+	registry.Preload()
+	require.Eventually(t, func() bool { return registry.runningEntry("fake") != nil }, 2*time.Second, 10*time.Millisecond)
+	registry.closeIdleClients(time.Now().Add(2 * time.Minute))
+	require.Nil(t, registry.runningEntry("fake"))
+
+	// A reload that leaves the server as it was does not bring it back
+	changed := registry.SetServerConfigs(map[string]*config.MCPClientConfigV2{
+		"fake": {Options: &config.OptionsV2{Preload: optional.NewField(true), IdleTimeout: config.Duration(time.Minute)}},
+	})
+	assert.Empty(t, changed)
+	registry.PreloadServers(changed)
+
+	// A new server marked preload is started
+	changed = registry.SetServerConfigs(map[string]*config.MCPClientConfigV2{
+		"fake":  {Options: &config.OptionsV2{Preload: optional.NewField(true), IdleTimeout: config.Duration(time.Minute)}},
+		"added": {Options: &config.OptionsV2{Preload: optional.NewField(true)}},
+	})
+	assert.Equal(t, []string{"added"}, changed)
+	registry.PreloadServers(changed)
+	require.Eventually(t, func() bool { return registry.runningEntry("added") != nil }, 2*time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, registry.runningEntry("fake"), "an idle server is not restarted by a reload")
+	assert.Equal(t, int32(2), backend.starts.Load())
+}
+
+// recordingObserver remembers the startups reported by a registry
+type recordingObserver struct {
+	mu     sync.Mutex
+	starts []error
+}
+
+func (o *recordingObserver) ServerStarted(serverName string, took time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.starts = append(o.starts, err)
+}
+
+func (o *recordingObserver) PingFailed(serverName string) {}
+
+func TestRegistryReportsStartupsToObserver(t *testing.T) {
+	ctx := context.Background()
+	backend := newFakeBackend()
+	registry := newTestRegistry(backend)
+	observer := &recordingObserver{}
+	registry.SetObserver(observer)
+	defer registry.Close()
+
+	startErr := errors.New("command not found")
+	backend.startErr.Store(&startErr)
+	_, err := registry.GetOrLoadServer(ctx, "fake")
+	require.Error(t, err)
+	assert.Equal(t, 0, registry.RunningCount())
+
+	backend.startErr.Store(nil)
+	require.NoError(t, callEcho(ctx, registry))
+	require.NoError(t, callEcho(ctx, registry))
+	assert.Equal(t, 1, registry.RunningCount())
+
+	// Only cold starts are reported; the warm call is not
+	require.Len(t, observer.starts, 2)
+	assert.ErrorIs(t, observer.starts[0], startErr)
+	assert.NoError(t, observer.starts[1])
+}
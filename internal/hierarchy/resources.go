@@ -0,0 +1,322 @@
+package hierarchy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/voicetreelab/lazy-mcp/internal/client"
+)
+
+// promptInfo builds the per-prompt entry of a get_tools_in_category or list_prompts response
+func promptInfo(promptDef *PromptDefinition, promptPath string) map[string]interface{} {
+	info := map[string]interface{}{
+		"description": promptDef.Description,
+		"prompt_path": promptPath,
+		"server":      promptDef.Server,
+	}
+	if len(promptDef.Arguments) > 0 {
+		info["arguments"] = promptDef.Arguments
+	}
+	return info
+}
+
+// resourceInfo builds the per-resource entry of a get_tools_in_category or list_resources response
+func resourceInfo(resourceDef *ResourceDefinition) map[string]interface{} {
+	info := map[string]interface{}{
+		"description": resourceDef.Description,
+		"uri":         resourceDef.URI,
+		"server":      resourceDef.Server,
+	}
+	if resourceDef.MIMEType != "" {
+		info["mimeType"] = resourceDef.MIMEType
+	}
+	return info
+}
+
+// HandleListResources handles the list_resources meta-tool
+// Without a server it lists the resources declared in the hierarchy. With a server it
+// starts that server if needed and lists its live resources and resource templates.
+// Servers the caller's policy denies (see CheckServerAccess) are hidden and refused.
+func (h *Hierarchy) HandleListResources(ctx context.Context, registry *ServerRegistry, serverName string) (map[string]interface{}, error) {
+	policy := AccessPolicyFromContext(ctx)
+	if serverName == "" {
+		return map[string]interface{}{
+			"resources": h.declaredResources(policy),
+		}, nil
+	}
+	if err := h.CheckServerAccess(policy, serverName); err != nil {
+		return nil, err
+	}
+
+	resources := make([]mcp.Resource, 0)
+	templates := make([]mcp.ResourceTemplate, 0)
+	err := callServer(ctx, registry, serverName, func(ctx context.Context, c *client.Client) error {
+		request := mcp.ListResourcesRequest{}
+		for {
+			result, err := c.GetClient().ListResources(ctx, request)
+			if err != nil {
+				return err
+			}
+			resources = append(resources, result.Resources...)
+			if result.NextCursor == "" {
+				break
+			}
+			request.Params.Cursor = result.NextCursor
+		}
+
+		templatesRequest := mcp.ListResourceTemplatesRequest{}
+		for {
+			result, err := c.GetClient().ListResourceTemplates(ctx, templatesRequest)
+			if err != nil {
+				if isMethodNotFound(err) {
+					break // Resource templates are optional, the server has none
+				}
+				return err
+			}
+			templates = append(templates, result.ResourceTemplates...)
+			if result.NextCursor == "" {
+				break
+			}
+			templatesRequest.Params.Cursor = result.NextCursor
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resources of server %s: %w", serverName, err)
+	}
+
+	return map[string]interface{}{
+		"server":             serverName,
+		"resources":          resources,
+		"resource_templates": templates,
+	}, nil
+}
+
+// HandleReadResource handles the read_resource meta-tool
+// The owning server is taken from the hierarchy when serverName is empty.
+func (h *Hierarchy) HandleReadResource(ctx context.Context, registry *ServerRegistry, uri string, serverName string) (*mcp.CallToolResult, error) {
+	if serverName == "" {
+		serverName = h.resourceServer(uri)
+		if serverName == "" {
+			return nil, fmt.Errorf("resource %s is not declared in the hierarchy, pass the server that owns it", uri)
+		}
+	}
+	if err := h.CheckServerAccess(AccessPolicyFromContext(ctx), serverName); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Reading resource: uri=%s, server=%s", uri, serverName)
+
+	var contents []mcp.ResourceContents
+	err := callServer(ctx, registry, serverName, func(ctx context.Context, c *client.Client) error {
+		request := mcp.ReadResourceRequest{}
+		request.Params.URI = uri
+		result, err := c.GetClient().ReadResource(ctx, request)
+		if err != nil {
+			return err
+		}
+		contents = result.Contents
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resource %s from server %s: %w", uri, serverName, err)
+	}
+
+	result := &mcp.CallToolResult{Content: make([]mcp.Content, 0, len(contents))}
+	for _, content := range contents {
+		result.Content = append(result.Content, mcp.NewEmbeddedResource(content))
+	}
+	return result, nil
+}
+
+// HandleListPrompts handles the list_prompts meta-tool
+// Without a server it lists the prompts declared in the hierarchy. With a server it
+// starts that server if needed and lists its live prompts.
+func (h *Hierarchy) HandleListPrompts(ctx context.Context, registry *ServerRegistry, serverName string) (map[string]interface{}, error) {
+	policy := AccessPolicyFromContext(ctx)
+	if serverName == "" {
+		return map[string]interface{}{
+			"prompts": h.declaredPrompts(policy),
+		}, nil
+	}
+	if err := h.CheckServerAccess(policy, serverName); err != nil {
+		return nil, err
+	}
+
+	prompts := make([]mcp.Prompt, 0)
+	err := callServer(ctx, registry, serverName, func(ctx context.Context, c *client.Client) error {
+		request := mcp.ListPromptsRequest{}
+		for {
+			result, err := c.GetClient().ListPrompts(ctx, request)
+			if err != nil {
+				return err
+			}
+			prompts = append(prompts, result.Prompts...)
+			if result.NextCursor == "" {
+				break
+			}
+			request.Params.Cursor = result.NextCursor
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompts of server %s: %w", serverName, err)
+	}
+
+	return map[string]interface{}{
+		"server":  serverName,
+		"prompts": prompts,
+	}, nil
+}
+
+// HandleGetPrompt handles the get_prompt meta-tool
+// A prompt is addressed either by its prompt_path in the hierarchy, or by server and upstream name.
+func (h *Hierarchy) HandleGetPrompt(ctx context.Context, registry *ServerRegistry, promptPath, serverName, promptName string, arguments map[string]string) (*mcp.GetPromptResult, error) {
+	if promptPath != "" {
+		promptDef, err := h.ResolvePromptPath(promptPath)
+		if err != nil {
+			return nil, err
+		}
+		if promptDef.Server == "" {
+			return nil, fmt.Errorf("no MCP server configured for prompt: %s", promptPath)
+		}
+		serverName = promptDef.Server
+		promptName = promptDef.MapsTo
+	}
+	if serverName == "" || promptName == "" {
+		return nil, fmt.Errorf("either prompt_path or both server and name are required")
+	}
+	if err := h.CheckServerAccess(AccessPolicyFromContext(ctx), serverName); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Getting prompt: prompt_path=%s, server=%s, prompt=%s", promptPath, serverName, promptName)
+
+	var result *mcp.GetPromptResult
+	err := callServer(ctx, registry, serverName, func(ctx context.Context, c *client.Client) error {
+		request := mcp.GetPromptRequest{}
+		request.Params.Name = promptName
+		request.Params.Arguments = arguments
+		var err error
+		result, err = c.GetClient().GetPrompt(ctx, request)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prompt %s from server %s: %w", promptName, serverName, err)
+	}
+	return result, nil
+}
+
+// ResolvePromptPath resolves a prompt_path (e.g., "coding_tools.github.review_pr") to its definition
+func (h *Hierarchy) ResolvePromptPath(promptPath string) (*PromptDefinition, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	promptName := promptPath
+	if i := strings.LastIndex(promptPath, "."); i >= 0 {
+		promptName = promptPath[i+1:]
+	}
+
+	// Like tool paths, the node path may already end with the prompt name
+	for _, nodePath := range []string{promptPath, parentPath(promptPath)} {
+		if node, ok := h.nodes[nodePath]; ok {
+			if promptDef, ok := node.Prompts[promptName]; ok {
+				return promptDef, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("prompt not found: %s", promptPath)
+}
+
+// declaredPrompts returns every prompt in the hierarchy whose server policy allows, sorted by prompt_path
+func (h *Hierarchy) declaredPrompts(policy *AccessPolicy) []map[string]interface{} {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	prompts := make([]map[string]interface{}, 0)
+	for nodePath, node := range h.eachNode() {
+		for promptName, promptDef := range node.Prompts {
+			if !h.serverAllowed(policy, promptDef.Server) {
+				continue
+			}
+			prompts = append(prompts, promptInfo(promptDef, toolPathFor(nodePath, promptName)))
+		}
+	}
+	sort.Slice(prompts, func(i, j int) bool {
+		return prompts[i]["prompt_path"].(string) < prompts[j]["prompt_path"].(string)
+	})
+	return prompts
+}
+
+// declaredResources returns every resource in the hierarchy whose server policy allows, sorted by URI
+func (h *Hierarchy) declaredResources(policy *AccessPolicy) []map[string]interface{} {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	resources := make([]map[string]interface{}, 0)
+	for _, node := range h.eachNode() {
+		for _, resourceDef := range node.Resources {
+			if !h.serverAllowed(policy, resourceDef.Server) {
+				continue
+			}
+			resources = append(resources, resourceInfo(resourceDef))
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i]["uri"].(string) < resources[j]["uri"].(string)
+	})
+	return resources
+}
+
+// resourceServer returns the server of the resource declared with the given URI, or "" if there is none
+func (h *Hierarchy) resourceServer(uri string) string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, node := range h.eachNode() {
+		for _, resourceDef := range node.Resources {
+			if resourceDef.URI == uri {
+				return resourceDef.Server
+			}
+		}
+	}
+	return ""
+}
+
+// isMethodNotFound reports whether err is the JSON-RPC reply of a server that does not implement the method
+// The MCP client only keeps the error message, so the messages of mcp-go and the official SDKs are matched.
+func isMethodNotFound(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "method not found") ||
+		strings.HasSuffix(message, "not supported") ||
+		(strings.HasPrefix(message, "method ") && strings.HasSuffix(message, " not found"))
+}
+
+// callServer runs fn against the lazily loaded client of serverName, bounded by the server's toolTimeout
+// Failures are reported to the registry so crashed servers are restarted like for execute_tool.
+func callServer(ctx context.Context, registry *ServerRegistry, serverName string, fn func(ctx context.Context, c *client.Client) error) error {
+	c, err := registry.GetOrLoadServer(ctx, serverName)
+	if err != nil {
+		return fmt.Errorf("failed to get MCP client: %w", err)
+	}
+	defer registry.TrackCall(serverName, c)()
+
+	serverCfg, _ := registry.ServerConfig(serverName)
+	timeout, _ := effectiveTimeout(&ToolDefinition{}, serverCfg)
+
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := fn(callCtx, c); err != nil {
+		if ctx.Err() == nil {
+			registry.ReportFailure(serverName, c, err)
+		}
+		return err
+	}
+	registry.ReportSuccess(serverName)
+	return nil
+}
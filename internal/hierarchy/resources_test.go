@@ -0,0 +1,107 @@
+package hierarchy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var promptNodes = map[string]string{
+	"root.json": `{"overview": "root"}`,
+	"fake/fake.json": `{
+		"overview": "Fake server",
+		"mcp_server": {"name": "fake", "command": "fake-server"},
+		"prompts": {
+			"hello": {"description": "Say hello", "maps_to": "greet", "arguments": [{"name": "name", "required": true}]}
+		},
+		"resources": {
+			"readme": {"description": "Project readme", "uri": "file:///readme.md", "mimeType": "text/markdown"}
+		}
+	}`,
+}
+
+func TestPromptAndResourceNodes(t *testing.T) {
+	h := newTestHierarchy(t, promptNodes)
+
+	result, err := h.HandleGetToolsInCategory("fake")
+	require.NoError(t, err)
+
+	prompts := result["prompts"].(map[string]interface{})
+	hello := prompts["hello"].(map[string]interface{})
+	assert.Equal(t, "fake.hello", hello["prompt_path"])
+	assert.Equal(t, "fake", hello["server"], "prompts inherit the nearest mcp_server")
+
+	resources := result["resources"].(map[string]interface{})
+	readme := resources["readme"].(map[string]interface{})
+	assert.Equal(t, "file:///readme.md", readme["uri"])
+	assert.Equal(t, "fake", readme["server"])
+
+	promptDef, err := h.ResolvePromptPath("fake.hello")
+	require.NoError(t, err)
+	assert.Equal(t, "greet", promptDef.MapsTo)
+
+	_, err = h.ResolvePromptPath("fake.missing")
+	assert.Error(t, err)
+}
+
+func TestPromptAndResourceMetaTools(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHierarchy(t, promptNodes)
+	backend := newFakeBackend()
+	registry := newTestRegistry(backend)
+	defer registry.Close()
+
+	t.Run("declared listings do not start servers", func(t *testing.T) {
+		result, err := h.HandleListPrompts(ctx, registry, "")
+		require.NoError(t, err)
+		assert.Len(t, result["prompts"], 1)
+
+		result, err = h.HandleListResources(ctx, registry, "")
+		require.NoError(t, err)
+		assert.Len(t, result["resources"], 1)
+
+		assert.Equal(t, int32(0), backend.starts.Load())
+	})
+
+	t.Run("get_prompt by prompt_path lazily starts the server", func(t *testing.T) {
+		result, err := h.HandleGetPrompt(ctx, registry, "fake.hello", "", "", map[string]string{"name": "Ada"})
+		require.NoError(t, err)
+		require.Len(t, result.Messages, 1)
+		assert.Equal(t, "Hello, Ada", result.Messages[0].Content.(mcp.TextContent).Text)
+		assert.Equal(t, int32(1), backend.starts.Load())
+	})
+
+	t.Run("read_resource resolves the server from the hierarchy", func(t *testing.T) {
+		result, err := h.HandleReadResource(ctx, registry, "file:///readme.md", "")
+		require.NoError(t, err)
+		require.Len(t, result.Content, 1)
+		embedded := result.Content[0].(mcp.EmbeddedResource)
+		assert.Equal(t, "# Fake", embedded.Resource.(mcp.TextResourceContents).Text)
+
+		_, err = h.HandleReadResource(ctx, registry, "file:///unknown.md", "")
+		assert.ErrorContains(t, err, "not declared in the hierarchy")
+	})
+
+	t.Run("live listings by server", func(t *testing.T) {
+		result, err := h.HandleListPrompts(ctx, registry, "fake")
+		require.NoError(t, err)
+		assert.Len(t, result["prompts"], 1)
+
+		result, err = h.HandleListResources(ctx, registry, "fake")
+		require.NoError(t, err)
+		assert.Len(t, result["resources"], 1)
+	})
+
+	t.Run("servers without resource templates list none", func(t *testing.T) {
+		backend.noTemplates.Store(true)
+		defer backend.noTemplates.Store(false)
+
+		result, err := h.HandleListResources(ctx, registry, "fake")
+		require.NoError(t, err)
+		assert.Len(t, result["resources"], 1)
+		assert.Empty(t, result["resource_templates"])
+	})
+}
@@ -0,0 +1,225 @@
+package hierarchy
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// BM25 tuning parameters (standard defaults)
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	// nameBoost repeats tool name tokens so name matches outrank incidental description matches
+	nameBoost = 3
+
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+
+	searchDescriptionLength = 200
+)
+
+// searchDocument is a single tool leaf indexed for search
+type searchDocument struct {
+	toolPath    string
+	description string
+	terms       map[string]int
+	length      int
+}
+
+// HandleSearchTools handles the search_tools meta-tool
+// Ranks every tool in the hierarchy against the query with BM25 and returns the best matches
+func (h *Hierarchy) HandleSearchTools(query string, limit int) (map[string]interface{}, error) {
+	return h.HandleSearchToolsWithPolicy(query, limit, nil)
+}
+
+// HandleSearchToolsWithPolicy is HandleSearchTools restricted to the tools policy allows
+func (h *Hierarchy) HandleSearchToolsWithPolicy(query string, limit int, policy *AccessPolicy) (map[string]interface{}, error) {
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	queryTerms := tokenize(query)
+	results := make([]map[string]interface{}, 0)
+
+	if len(queryTerms) > 0 {
+		docs := h.searchDocuments(policy)
+		for _, match := range rankDocuments(docs, queryTerms, limit) {
+			results = append(results, map[string]interface{}{
+				"tool_path":   match.doc.toolPath,
+				"description": truncate(match.doc.description, searchDescriptionLength),
+				"score":       math.Round(match.score*1000) / 1000,
+			})
+		}
+	}
+
+	return map[string]interface{}{
+		"query":   query,
+		"results": results,
+	}, nil
+}
+
+// searchDocuments builds one document per tool leaf from its name, description,
+// the overview of the node that holds it, and its input schema property names.
+// Tools the policy denies are left out.
+func (h *Hierarchy) searchDocuments(policy *AccessPolicy) []*searchDocument {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	docs := make([]*searchDocument, 0)
+	for nodePath, node := range h.eachNode() {
+		for toolName, toolDef := range node.Tools {
+			if !policy.Allows(toolPathFor(nodePath, toolName)) {
+				continue
+			}
+			doc := &searchDocument{
+				toolPath:    toolPathFor(nodePath, toolName),
+				description: toolDef.Description,
+				terms:       make(map[string]int),
+			}
+
+			var terms []string
+			nameTerms := tokenize(toolName)
+			for i := 0; i < nameBoost; i++ {
+				terms = append(terms, nameTerms...)
+			}
+			terms = append(terms, tokenize(strings.ReplaceAll(nodePath, ".", " "))...)
+			terms = append(terms, tokenize(toolDef.Description)...)
+			terms = append(terms, tokenize(node.Overview)...)
+			if properties, ok := toolDef.InputSchema["properties"].(map[string]interface{}); ok {
+				for propName := range properties {
+					terms = append(terms, tokenize(propName)...)
+				}
+			}
+
+			for _, term := range terms {
+				doc.terms[term]++
+			}
+			doc.length = len(terms)
+			docs = append(docs, doc)
+		}
+	}
+
+	return docs
+}
+
+type searchMatch struct {
+	doc   *searchDocument
+	score float64
+}
+
+// rankDocuments scores docs with Okapi BM25 and returns the top limit matches with a positive score
+func rankDocuments(docs []*searchDocument, queryTerms []string, limit int) []searchMatch {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	totalLength := 0
+	docFreq := make(map[string]int)
+	for _, doc := range docs {
+		totalLength += doc.length
+		for term := range doc.terms {
+			docFreq[term]++
+		}
+	}
+	avgLength := float64(totalLength) / float64(len(docs))
+	if avgLength == 0 {
+		avgLength = 1
+	}
+
+	n := float64(len(docs))
+	matches := make([]searchMatch, 0)
+	for _, doc := range docs {
+		score := 0.0
+		for _, term := range queryTerms {
+			tf := float64(doc.terms[term])
+			if tf == 0 {
+				continue
+			}
+			df := float64(docFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := tf + bm25K1*(1-bm25B+bm25B*float64(doc.length)/avgLength)
+			score += idf * tf * (bm25K1 + 1) / norm
+		}
+		if score > 0 {
+			matches = append(matches, searchMatch{doc: doc, score: score})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].doc.toolPath < matches[j].doc.toolPath
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// tokenize lowercases text and splits it on punctuation, snake_case and camelCase boundaries
+func tokenize(text string) []string {
+	var tokens []string
+	var current []rune
+
+	flush := func() {
+		if len(current) > 0 {
+			tokens = append(tokens, normalizeTerm(string(current)))
+			current = current[:0]
+		}
+	}
+
+	runes := []rune(text)
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			// Start a new token at a camelCase boundary ("getTinyImage" -> get, tiny, image)
+			if len(current) > 0 && i > 0 && unicode.IsLower(runes[i-1]) {
+				flush()
+			}
+			current = append(current, unicode.ToLower(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			current = append(current, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// normalizeTerm applies a light plural stemming so "issues" matches "issue"
+func normalizeTerm(term string) string {
+	if len(term) > 3 && strings.HasSuffix(term, "s") && !strings.HasSuffix(term, "ss") {
+		return strings.TrimSuffix(term, "s")
+	}
+	return term
+}
+
+// toolPathFor returns the tool_path of a tool held by the node at nodePath
+// In the flat structure the node path already ends with the tool name (e.g., "everything.echo")
+func toolPathFor(nodePath, toolName string) string {
+	if nodePath == "" {
+		return toolName
+	}
+	if nodePath == toolName || strings.HasSuffix(nodePath, "."+toolName) {
+		return nodePath
+	}
+	return nodePath + "." + toolName
+}
+
+func truncate(text string, maxLen int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLen {
+		return text
+	}
+	return string(runes[:maxLen]) + "..."
+}
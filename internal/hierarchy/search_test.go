@@ -0,0 +1,48 @@
+package hierarchy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"get", "tiny", "image"}, tokenize("getTinyImage"))
+	assert.Equal(t, []string{"create", "issue"}, tokenize("create_issues"))
+	assert.Equal(t, []string{"print", "env", "var"}, tokenize("Print env-vars!"))
+}
+
+func TestSearchTools(t *testing.T) {
+	h := loadTestHierarchy(t)
+
+	t.Run("ranks name matches first", func(t *testing.T) {
+		response, err := h.HandleSearchTools("environment variables", 3)
+		require.NoError(t, err)
+
+		results := response["results"].([]map[string]interface{})
+		require.NotEmpty(t, results)
+		assert.Equal(t, "everything.printEnv", results[0]["tool_path"])
+	})
+
+	t.Run("matches schema property names", func(t *testing.T) {
+		response, err := h.HandleSearchTools("location", 5)
+		require.NoError(t, err)
+
+		results := response["results"].([]map[string]interface{})
+		require.NotEmpty(t, results)
+		assert.Equal(t, "everything.structuredContent", results[0]["tool_path"])
+	})
+
+	t.Run("respects limit", func(t *testing.T) {
+		response, err := h.HandleSearchTools("returns", 2)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(response["results"].([]map[string]interface{})), 2)
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		response, err := h.HandleSearchTools("kubernetes", 5)
+		require.NoError(t, err)
+		assert.Empty(t, response["results"])
+	})
+}
@@ -0,0 +1,165 @@
+package hierarchy
+
+import (
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+)
+
+// applyServerRefs wires tools, prompts and resources to the mcp_server blocks declared in the hierarchy.
+// A tool without an explicit "server" uses the nearest mcp_server block on its own node or an ancestor,
+// and a tool without an explicit "maps_to" is looked up in that block's tool_mappings
+// before falling back to its own name.
+// Returns the client configs of every mcp_server block, keyed by server name.
+func applyServerRefs(nodes map[string]*HierarchyNode) map[string]*config.MCPClientConfigV2 {
+	serverConfigs := make(map[string]*config.MCPClientConfigV2)
+	declaredAt := make(map[string]string)
+
+	// Visit nodes in a stable order so duplicate declarations resolve the same way every load
+	paths := make([]string, 0, len(nodes))
+	for nodePath := range eachNode(nodes) {
+		paths = append(paths, nodePath)
+	}
+	sort.Strings(paths)
+
+	for _, nodePath := range paths {
+		ref := nodes[nodePath].MCPServer
+		if ref == nil {
+			continue
+		}
+		if ref.Name == "" {
+			log.Printf("Warning: mcp_server block at %q has no name, ignoring it", nodePath)
+			continue
+		}
+
+		cfg := ref.ToClientConfig()
+		if existing, ok := serverConfigs[ref.Name]; ok {
+			if !reflect.DeepEqual(existing, cfg) {
+				log.Printf("Warning: mcp_server %q is declared differently at %q and %q, using the one at %q",
+					ref.Name, declaredAt[ref.Name], nodePath, declaredAt[ref.Name])
+			}
+			continue
+		}
+		serverConfigs[ref.Name] = cfg
+		declaredAt[ref.Name] = nodePath
+	}
+
+	for _, nodePath := range paths {
+		node := nodes[nodePath]
+		ref := nearestServerRef(nodes, nodePath)
+		for toolName, tool := range node.Tools {
+			if ref != nil && ref.Name != "" && tool.Server == "" {
+				tool.Server = ref.Name
+			}
+			if tool.MapsTo == "" {
+				tool.MapsTo = mappedToolName(ref, tool, toolName)
+			}
+		}
+		for promptName, prompt := range node.Prompts {
+			if ref != nil && ref.Name != "" && prompt.Server == "" {
+				prompt.Server = ref.Name
+			}
+			if prompt.MapsTo == "" {
+				prompt.MapsTo = promptName
+			}
+		}
+		for _, resource := range node.Resources {
+			if ref != nil && ref.Name != "" && resource.Server == "" {
+				resource.Server = ref.Name
+			}
+		}
+	}
+
+	return serverConfigs
+}
+
+// mappedToolName returns the upstream name of a tool that has no explicit maps_to
+// tool_mappings only applies when the tool runs on the server that declares them
+func mappedToolName(ref *MCPServerRef, tool *ToolDefinition, toolName string) string {
+	if ref != nil && ref.Name == tool.Server {
+		if mapped, ok := ref.ToolMappings[toolName]; ok && mapped != "" {
+			return mapped
+		}
+	}
+	// Default maps_to is the tool name itself
+	return toolName
+}
+
+// nearestServerRef returns the mcp_server block of the node at nodePath or of its closest ancestor
+func nearestServerRef(nodes map[string]*HierarchyNode, nodePath string) *MCPServerRef {
+	for current := nodePath; ; current = parentPath(current) {
+		if node, ok := nodes[current]; ok && node.MCPServer != nil {
+			return node.MCPServer
+		}
+		if current == "" {
+			return nil
+		}
+	}
+}
+
+// parentPath returns the parent of a dot-notation hierarchy path ("" for top-level nodes)
+func parentPath(nodePath string) string {
+	if i := strings.LastIndex(nodePath, "."); i >= 0 {
+		return nodePath[:i]
+	}
+	return ""
+}
+
+// ServerConfigs returns the client configs declared by mcp_server blocks in the hierarchy
+func (h *Hierarchy) ServerConfigs() map[string]*config.MCPClientConfigV2 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	configs := make(map[string]*config.MCPClientConfigV2, len(h.serverConfigs))
+	for name, cfg := range h.serverConfigs {
+		configs[name] = cfg
+	}
+	return configs
+}
+
+// MergeServerConfigs combines the servers from config.json with those declared in the hierarchy.
+// config.json takes precedence: a same-named mcp_server block in the hierarchy is ignored and
+// the conflict is logged. Hierarchy-only servers inherit the mcpProxy options like config.json servers do.
+func MergeServerConfigs(fromConfig, fromHierarchy map[string]*config.MCPClientConfigV2, proxyOptions *config.OptionsV2) map[string]*config.MCPClientConfigV2 {
+	merged := make(map[string]*config.MCPClientConfigV2, len(fromConfig)+len(fromHierarchy))
+	for name, cfg := range fromConfig {
+		merged[name] = cfg
+	}
+
+	for name, cfg := range fromHierarchy {
+		if _, exists := merged[name]; exists {
+			log.Printf("Warning: server %q is defined in both config.json and the hierarchy, using config.json", name)
+			continue
+		}
+		serverCfg := *cfg
+		if cfg.Options != nil {
+			options := *cfg.Options
+			serverCfg.Options = &options
+		}
+		config.InheritProxyOptions(proxyOptions, &serverCfg)
+		merged[name] = &serverCfg
+		log.Printf("Registered server %q from hierarchy mcp_server block", name)
+	}
+
+	return merged
+}
+
+// ServerToolPaths returns the paths of every tool that runs on the given server, sorted
+func (h *Hierarchy) ServerToolPaths(serverName string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	paths := make([]string, 0)
+	for nodePath, node := range h.eachNode() {
+		for toolName, toolDef := range node.Tools {
+			if toolDef.Server == serverName {
+				paths = append(paths, toolPathFor(nodePath, toolName))
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
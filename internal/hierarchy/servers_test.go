@@ -0,0 +1,76 @@
+package hierarchy
+
+import (
+	"testing"
+
+	"github.com/TBXark/optional-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+)
+
+func TestHierarchyServerBlocks(t *testing.T) {
+	h := newTestHierarchy(t, map[string]string{
+		"root.json": `{"overview": "root"}`,
+		"github/github.json": `{
+			"overview": "GitHub",
+			"mcp_server": {
+				"name": "github", "type": "stdio", "command": "npx", "args": ["-y", "server-github"],
+				"tool_mappings": {"create_issue": "issues_create", "list_issues": "issues_list", "merge": "pulls_merge"}
+			}
+		}`,
+		"github/create_issue.json": `{"tools": {"create_issue": {"description": "Create an issue"}}}`,
+		"github/list_issues.json":  `{"tools": {"list_issues": {"maps_to": "search_issues"}}}`,
+		"github/get_me.json":       `{"tools": {"get_me": {}}}`,
+		"github/pulls/pulls.json":  `{"tools": {"merge": {"server": "other"}}}`,
+	})
+
+	t.Run("tools inherit the nearest mcp_server", func(t *testing.T) {
+		_, serverName, err := h.ResolveToolPath("github.create_issue")
+		require.NoError(t, err)
+		assert.Equal(t, "github", serverName)
+
+		_, serverName, err = h.ResolveToolPath("github.pulls.merge")
+		require.NoError(t, err)
+		assert.Equal(t, "other", serverName, "explicit server wins over the inherited one")
+	})
+
+	t.Run("tool_mappings rename tools without maps_to", func(t *testing.T) {
+		toolDef, _, err := h.ResolveToolPath("github.create_issue")
+		require.NoError(t, err)
+		assert.Equal(t, "issues_create", toolDef.MapsTo)
+
+		toolDef, _, err = h.ResolveToolPath("github.list_issues")
+		require.NoError(t, err)
+		assert.Equal(t, "search_issues", toolDef.MapsTo, "explicit maps_to wins over tool_mappings")
+
+		toolDef, _, err = h.ResolveToolPath("github.get_me")
+		require.NoError(t, err)
+		assert.Equal(t, "get_me", toolDef.MapsTo, "unmapped tools keep their name")
+
+		toolDef, _, err = h.ResolveToolPath("github.pulls.merge")
+		require.NoError(t, err)
+		assert.Equal(t, "merge", toolDef.MapsTo, "mappings only apply to tools on the declaring server")
+	})
+
+	t.Run("mcp_server blocks are collected", func(t *testing.T) {
+		configs := h.ServerConfigs()
+		require.Contains(t, configs, "github")
+		assert.Equal(t, config.MCPClientTypeStdio, configs["github"].TransportType)
+		assert.Equal(t, "npx", configs["github"].Command)
+	})
+
+	t.Run("config.json takes precedence", func(t *testing.T) {
+		fromConfig := map[string]*config.MCPClientConfigV2{
+			"github": {Command: "docker", Options: &config.OptionsV2{}},
+		}
+		proxyOptions := &config.OptionsV2{LogEnabled: optional.NewField(true)}
+
+		merged := MergeServerConfigs(fromConfig, h.ServerConfigs(), proxyOptions)
+		assert.Equal(t, "docker", merged["github"].Command)
+
+		merged = MergeServerConfigs(nil, h.ServerConfigs(), proxyOptions)
+		assert.Equal(t, "npx", merged["github"].Command)
+		assert.True(t, merged["github"].Options.LogEnabled.OrElse(false), "hierarchy servers inherit proxy options")
+	})
+}
@@ -0,0 +1,86 @@
+package hierarchy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/tracing"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spansByName groups the spans an in-memory exporter received by name, in export order
+func spansByName(exporter *tracetest.InMemoryExporter) map[string][]tracetest.SpanStub {
+	spans := make(map[string][]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = append(spans[span.Name], span)
+	}
+	return spans
+}
+
+// attributeValue returns the value of the span attribute key, or nil if it is not set
+func attributeValue(span tracetest.SpanStub, key string) interface{} {
+	for _, attr := range span.Attributes {
+		if string(attr.Key) == key {
+			return attr.Value.AsInterface()
+		}
+	}
+	return nil
+}
+
+func TestExecuteToolTracesDownstreamCalls(t *testing.T) {
+	backend := newFakeBackend()
+	var received []string
+	backend.server.AddTool(mcp.NewTool("whoami"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if meta := request.Params.Meta; meta != nil {
+			received = append(received, meta.AdditionalFields[tracing.TraceparentHeader].(string))
+		}
+		return mcp.NewToolResultText("fake"), nil
+	})
+
+	h := newTestHierarchy(t, map[string]string{
+		"root.json":        `{"overview": "root"}`,
+		"fake/fake.json":   `{"mcp_server": {"name": "fake", "command": "fake-mcp"}}`,
+		"fake/whoami.json": `{"tools": {"whoami": {}}}`,
+	})
+
+	registry := NewServerRegistry(h.ServerConfigs())
+	registry.newClient = backend.newClient
+	defer registry.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer provider.Shutdown(context.Background())
+
+	ctx, root := provider.Tracer(tracing.ScopeName).Start(context.Background(), "execute_tool")
+	for i := 0; i < 2; i++ {
+		_, err := h.HandleExecuteTool(ctx, registry, "fake.whoami", map[string]interface{}{})
+		require.NoError(t, err)
+	}
+	root.End()
+
+	spans := spansByName(exporter)
+	require.Len(t, spans["ServerRegistry.GetOrLoadServer"], 2)
+	require.Len(t, spans["Initialize"], 1, "only the cold start initializes the server")
+	require.Len(t, spans["CallTool whoami"], 2)
+
+	cold, warm := spans["ServerRegistry.GetOrLoadServer"][0], spans["ServerRegistry.GetOrLoadServer"][1]
+	assert.Equal(t, true, attributeValue(cold, "mcp.cold_start"))
+	assert.Equal(t, false, attributeValue(warm, "mcp.cold_start"))
+	assert.Equal(t, "fake", attributeValue(cold, "mcp.server"))
+
+	rootSpan := spans["execute_tool"][0].SpanContext
+	assert.Equal(t, rootSpan.SpanID(), cold.Parent.SpanID())
+	assert.Equal(t, cold.SpanContext.SpanID(), spans["Initialize"][0].Parent.SpanID(), "the startup is traced under the call that triggered it")
+	// stdio servers get the trace context of the CallTool span in _meta
+	require.Len(t, received, 2)
+	for i, call := range spans["CallTool whoami"] {
+		assert.Equal(t, rootSpan.TraceID(), call.SpanContext.TraceID())
+		assert.Equal(t, rootSpan.SpanID(), call.Parent.SpanID())
+		assert.Equal(t, "fake.whoami", attributeValue(call, "mcp.tool_path"))
+		assert.Equal(t, "00-"+call.SpanContext.TraceID().String()+"-"+call.SpanContext.SpanID().String()+"-01", received[i])
+	}
+}
@@ -0,0 +1,285 @@
+package hierarchy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// SchemaViolation describes a single argument that does not match the tool's input schema
+type SchemaViolation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned by ValidateArguments when arguments do not match the stored inputSchema
+// Its message lists every violation together with the expected schema so an agent can fix the call
+type ValidationError struct {
+	ToolPath   string
+	Violations []SchemaViolation
+	Schema     map[string]interface{}
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "invalid arguments for tool %s (%d problem(s)):\n", e.ToolPath, len(e.Violations))
+	for _, v := range e.Violations {
+		fmt.Fprintf(&sb, "  - %s: %s\n", v.Path, v.Message)
+	}
+	if schemaBytes, err := json.MarshalIndent(e.Schema, "", "  "); err == nil {
+		sb.WriteString("Expected input schema:\n")
+		sb.Write(schemaBytes)
+	}
+	return sb.String()
+}
+
+// Result returns the error as an isError tool result whose text is JSON with the violations and
+// the expected schema, so the model reads it like any tool output and can correct its call
+func (e *ValidationError) Result() *mcp.CallToolResult {
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"error":       fmt.Sprintf("invalid arguments for tool %s", e.ToolPath),
+		"tool_path":   e.ToolPath,
+		"violations":  e.Violations,
+		"inputSchema": e.Schema,
+	}, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(e.Error())
+	}
+	return mcp.NewToolResultError(string(data))
+}
+
+// ValidateArguments checks arguments against a JSON schema from the hierarchy
+// Supports type, required, properties, additionalProperties, enum, const and items.
+// Keywords it does not understand are ignored, so an unusual schema never blocks a call.
+func ValidateArguments(toolPath string, schema map[string]interface{}, arguments map[string]interface{}) error {
+	if len(schema) == 0 {
+		return nil
+	}
+
+	var violations []SchemaViolation
+	validateValue("arguments", schema, arguments, &violations)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return &ValidationError{
+		ToolPath:   toolPath,
+		Violations: violations,
+		Schema:     schema,
+	}
+}
+
+func validateValue(path string, schema map[string]interface{}, value interface{}, violations *[]SchemaViolation) {
+	addViolation := func(format string, args ...interface{}) {
+		*violations = append(*violations, SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if types := schemaTypes(schema); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if matchesType(t, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			addViolation("expected %s, got %s", strings.Join(types, " or "), jsonTypeOf(value))
+			return // Nested checks would only add noise
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		found := false
+		for _, allowed := range enum {
+			if jsonEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addViolation("value %s is not one of %s", formatJSON(value), formatJSON(enum))
+		}
+	}
+
+	if constVal, ok := schema["const"]; ok && !jsonEqual(constVal, value) {
+		addViolation("value must be %s", formatJSON(constVal))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		validateObject(path, schema, v, violations)
+	case []interface{}:
+		if itemSchema, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validateValue(fmt.Sprintf("%s[%d]", path, i), itemSchema, item, violations)
+			}
+		}
+	}
+}
+
+func validateObject(path string, schema map[string]interface{}, value map[string]interface{}, violations *[]SchemaViolation) {
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, ok := r.(string)
+			if !ok {
+				continue
+			}
+			if _, present := value[name]; !present {
+				msg := fmt.Sprintf("missing required property %q", name)
+				if propSchema, ok := properties[name].(map[string]interface{}); ok {
+					if types := schemaTypes(propSchema); len(types) > 0 {
+						msg += fmt.Sprintf(" (%s)", strings.Join(types, " or "))
+					}
+				}
+				*violations = append(*violations, SchemaViolation{Path: path, Message: msg})
+			}
+		}
+	}
+
+	// Walk properties in a stable order so error messages are deterministic
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propPath := path + "." + name
+		if propSchema, ok := properties[name].(map[string]interface{}); ok {
+			validateValue(propPath, propSchema, value[name], violations)
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				msg := "unexpected property"
+				if len(properties) > 0 {
+					msg += fmt.Sprintf(", allowed properties are %s", strings.Join(sortedKeys(properties), ", "))
+				}
+				*violations = append(*violations, SchemaViolation{Path: propPath, Message: msg})
+			}
+		case map[string]interface{}:
+			validateValue(propPath, additional, value[name], violations)
+		}
+	}
+}
+
+// schemaTypes returns the allowed JSON types of a schema ("type" may be a string or a list)
+func schemaTypes(schema map[string]interface{}) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func matchesType(schemaType string, value interface{}) bool {
+	switch schemaType {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "number":
+		_, ok := toFloat(value)
+		return ok
+	case "integer":
+		f, ok := toFloat(value)
+		return ok && f == math.Trunc(f)
+	}
+	return true // Unknown type keyword, don't block the call
+}
+
+func jsonTypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		if f, ok := toFloat(v); ok {
+			if f == math.Trunc(f) {
+				return "integer"
+			}
+			return "number"
+		}
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// jsonEqual compares two decoded JSON values, treating all numeric types alike
+func jsonEqual(a, b interface{}) bool {
+	af, aNum := toFloat(a)
+	bf, bNum := toFloat(b)
+	if aNum && bNum {
+		return af == bf
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func formatJSON(value interface{}) string {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(b)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
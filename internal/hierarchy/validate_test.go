@@ -0,0 +1,116 @@
+package hierarchy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+)
+
+func TestValidateArguments(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name":  map[string]interface{}{"type": "string"},
+			"count": map[string]interface{}{"type": "integer"},
+			"mode":  map[string]interface{}{"type": "string", "enum": []interface{}{"fast", "slow"}},
+			"options": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"depth": map[string]interface{}{"type": "number"},
+				},
+				"additionalProperties": false,
+			},
+			"tags": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+		},
+		"required":             []interface{}{"name"},
+		"additionalProperties": false,
+	}
+
+	t.Run("valid arguments", func(t *testing.T) {
+		err := ValidateArguments("test.tool", schema, map[string]interface{}{
+			"name":    "x",
+			"count":   float64(3),
+			"mode":    "fast",
+			"options": map[string]interface{}{"depth": 1.5},
+			"tags":    []interface{}{"a", "b"},
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("collects every violation", func(t *testing.T) {
+		err := ValidateArguments("test.tool", schema, map[string]interface{}{
+			"count":   1.5,
+			"mode":    "medium",
+			"options": map[string]interface{}{"depth": "deep", "extra": true},
+			"tags":    []interface{}{"a", 2.0},
+			"unknown": 1.0,
+		})
+		require.Error(t, err)
+
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		paths := make([]string, 0, len(validationErr.Violations))
+		for _, v := range validationErr.Violations {
+			paths = append(paths, v.Path)
+		}
+		assert.ElementsMatch(t, []string{
+			"arguments",
+			"arguments.count",
+			"arguments.mode",
+			"arguments.options.depth",
+			"arguments.options.extra",
+			"arguments.tags[1]",
+			"arguments.unknown",
+		}, paths)
+		assert.Contains(t, err.Error(), `missing required property "name"`)
+		assert.Contains(t, err.Error(), "Expected input schema")
+	})
+
+	t.Run("no schema accepts anything", func(t *testing.T) {
+		assert.NoError(t, ValidateArguments("test.tool", nil, map[string]interface{}{"a": 1.0}))
+	})
+}
+
+func TestExecuteToolValidatesBeforeLoadingServer(t *testing.T) {
+	h := loadTestHierarchy(t)
+	// An empty registry would fail with "server config not found" if validation did not run first
+	registry := NewServerRegistry(map[string]*config.MCPClientConfigV2{})
+	defer registry.Close()
+
+	exec := &Execution{}
+	result, err := h.HandleExecuteTool(WithExecution(context.Background(), exec), registry, "everything.add", map[string]interface{}{
+		"a": "one",
+	})
+	require.NoError(t, err, "the model gets the violations as a tool result it can read")
+	require.NotNil(t, exec.Validation)
+	require.True(t, result.IsError)
+
+	var body struct {
+		Error       string                 `json:"error"`
+		Violations  []SchemaViolation      `json:"violations"`
+		InputSchema map[string]interface{} `json:"inputSchema"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &body))
+	assert.Equal(t, "invalid arguments for tool everything.add", body.Error)
+	assert.Equal(t, toolSchema(t, h, "everything.add"), body.InputSchema)
+	paths := make([]string, 0, len(body.Violations))
+	for _, v := range body.Violations {
+		paths = append(paths, v.Path)
+	}
+	assert.Contains(t, paths, "arguments.a")
+}
+
+func toolSchema(t *testing.T, h *Hierarchy, toolPath string) map[string]interface{} {
+	t.Helper()
+	toolDef, _, err := h.ResolveToolPath(toolPath)
+	require.NoError(t, err)
+	return toolDef.InputSchema
+}
@@ -0,0 +1,85 @@
+package hierarchy
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultWatchInterval is how often Watch polls the hierarchy directory when no interval is configured
+const DefaultWatchInterval = 2 * time.Second
+
+// Watch polls the hierarchy directory and reloads it when any node file changes.
+// A change must be stable across two polls before it is applied, so a structure_generator
+// run that rewrites many files is picked up once instead of half-written.
+// onReload is called after every successful reload. Watch blocks until ctx is done.
+func (h *Hierarchy) Watch(ctx context.Context, interval time.Duration, onReload func()) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	h.mu.RLock()
+	applied := h.fingerprint
+	h.mu.RUnlock()
+	pending := applied
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Printf("Watching hierarchy %s for changes (every %s)", h.rootPath, interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current, err := fingerprintDir(h.rootPath)
+			if err != nil {
+				log.Printf("Warning: failed to fingerprint hierarchy %s: %v", h.rootPath, err)
+				continue
+			}
+			if current == applied {
+				pending = current
+				continue
+			}
+			if current != pending {
+				// Still changing, wait for it to settle
+				pending = current
+				continue
+			}
+
+			// Remember failed attempts too, so a broken file is reported once rather than on every poll
+			applied = current
+			if err := h.Reload(); err != nil {
+				log.Printf("Hierarchy reload failed, keeping the previous tree: %v", err)
+				continue
+			}
+			if onReload != nil {
+				onReload()
+			}
+		}
+	}
+}
+
+// fingerprintDir hashes the path, size and modification time of every JSON file under dir
+func fingerprintDir(dir string) (string, error) {
+	hash := sha256.New()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".json") {
+			return nil
+		}
+		_, _ = fmt.Fprintf(hash, "%s|%d|%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
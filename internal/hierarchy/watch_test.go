@@ -0,0 +1,64 @@
+package hierarchy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadKeepsTreeOnParseError(t *testing.T) {
+	dir := t.TempDir()
+	writeNode(t, filepath.Join(dir, "root.json"), `{"overview": "v1"}`)
+	writeNode(t, filepath.Join(dir, "tools", "echo.json"), `{"tools": {"echo": {"server": "s"}}}`)
+
+	h, err := LoadHierarchy(dir)
+	require.NoError(t, err)
+
+	writeNode(t, filepath.Join(dir, "tools", "broken.json"), `{"tools": `)
+	assert.Error(t, h.Reload())
+	assert.Equal(t, "v1", h.GetRootNode().Overview)
+	_, _, err = h.ResolveToolPath("tools.echo")
+	assert.NoError(t, err)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "tools", "broken.json")))
+	writeNode(t, filepath.Join(dir, "root.json"), `{"overview": "v2"}`)
+	require.NoError(t, h.Reload())
+	assert.Equal(t, "v2", h.GetRootNode().Overview)
+}
+
+func TestWatchReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	writeNode(t, filepath.Join(dir, "root.json"), `{"overview": "v1"}`)
+
+	h, err := LoadHierarchy(dir)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloaded := make(chan struct{}, 1)
+	go h.Watch(ctx, 10*time.Millisecond, func() {
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+	})
+
+	writeNode(t, filepath.Join(dir, "github", "create_issue.json"), `{"tools": {"create_issue": {"server": "github"}}}`)
+
+	select {
+	case <-reloaded:
+	case <-time.After(2 * time.Second):
+		t.Fatal("hierarchy was not reloaded")
+	}
+
+	toolDef, serverName, err := h.ResolveToolPath("github.create_issue")
+	require.NoError(t, err)
+	assert.Equal(t, "create_issue", toolDef.MapsTo)
+	assert.Equal(t, "github", serverName)
+}
@@ -0,0 +1,185 @@
+// Package redact scrubs secrets from text before it leaves the proxy
+package redact
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+)
+
+// Placeholder replaces every redacted secret
+const Placeholder = "[REDACTED]"
+
+// minSecretLength keeps short config values such as "1" or "true" from being redacted everywhere
+const minSecretLength = 8
+
+// Redactor replaces known secret values and matches of regular expressions with Placeholder
+// A nil Redactor leaves everything unchanged.
+type Redactor struct {
+	patterns []*regexp.Regexp
+
+	mu      sync.RWMutex
+	secrets *strings.Replacer
+}
+
+// New builds a redactor for the regular expressions in patterns
+// If a pattern has capture groups only the groups are redacted, e.g. `token=(\w+)` keeps "token=".
+func New(patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// SetSecrets replaces the literal values to redact; values shorter than 8 characters are ignored
+func (r *Redactor) SetSecrets(values []string) {
+	var secrets []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		if len(value) < minSecretLength || seen[value] {
+			continue
+		}
+		seen[value] = true
+		secrets = append(secrets, value)
+	}
+	// strings.Replacer tries the old strings in argument order, so longer secrets go first
+	// to win over secrets they contain
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+
+	var replacer *strings.Replacer
+	if len(secrets) > 0 {
+		pairs := make([]string, 0, 2*len(secrets))
+		for _, secret := range secrets {
+			pairs = append(pairs, secret, Placeholder)
+		}
+		replacer = strings.NewReplacer(pairs...)
+	}
+
+	r.mu.Lock()
+	r.secrets = replacer
+	r.mu.Unlock()
+}
+
+// String returns s with every secret redacted
+func (r *Redactor) String(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	r.mu.RLock()
+	secrets := r.secrets
+	r.mu.RUnlock()
+	if secrets != nil {
+		s = secrets.Replace(s)
+	}
+	for _, re := range r.patterns {
+		s = redactPattern(re, s)
+	}
+	return s
+}
+
+func redactPattern(re *regexp.Regexp, s string) string {
+	if re.NumSubexp() == 0 {
+		return re.ReplaceAllLiteralString(s, Placeholder)
+	}
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var sb strings.Builder
+	last := 0
+	for _, match := range matches {
+		for group := 1; group <= re.NumSubexp(); group++ {
+			start, end := match[2*group], match[2*group+1]
+			if start < last || start < 0 {
+				continue // Group did not take part in the match, or is nested in one already redacted
+			}
+			sb.WriteString(s[last:start])
+			sb.WriteString(Placeholder)
+			last = end
+		}
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
+// Value returns a copy of v with every string in it redacted, at any depth of maps and slices
+func (r *Redactor) Value(v interface{}) interface{} {
+	if r == nil {
+		return v
+	}
+	switch value := v.(type) {
+	case string:
+		return r.String(value)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			redacted[key] = r.Value(item)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(value))
+		for i, item := range value {
+			redacted[i] = r.Value(item)
+		}
+		return redacted
+	default:
+		return v
+	}
+}
+
+// Writer wraps w so that everything written through it is redacted, e.g. for log.SetOutput
+// Each Write is redacted on its own, which suits writers that get one log line per call.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	return &writer{redactor: r, w: w}
+}
+
+type writer struct {
+	redactor *Redactor
+	w        io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.redactor.String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ConfigSecrets collects the values the proxy is configured with that should never be shown:
+// the env and header values of every server and all authTokens. For header values with an
+// authorization scheme such as "Bearer <token>" the credential alone is included too.
+func ConfigSecrets(servers map[string]*config.MCPClientConfigV2, proxyOptions *config.OptionsV2) []string {
+	var secrets []string
+	addOptions := func(options *config.OptionsV2) {
+		if options != nil {
+			secrets = append(secrets, options.AuthTokens...)
+		}
+	}
+	addOptions(proxyOptions)
+	for _, server := range servers {
+		if server == nil {
+			continue
+		}
+		for _, value := range server.Env {
+			secrets = append(secrets, value)
+		}
+		for _, value := range server.Headers {
+			secrets = append(secrets, value)
+			if _, credential, ok := strings.Cut(value, " "); ok {
+				secrets = append(secrets, strings.TrimSpace(credential))
+			}
+		}
+		addOptions(server.Options)
+	}
+	return secrets
+}
@@ -0,0 +1,69 @@
+package redact
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+)
+
+func TestRedactorString(t *testing.T) {
+	r, err := New([]string{`ghp_[A-Za-z0-9]{8,}`, `password=(\S+)`})
+	require.NoError(t, err)
+	r.SetSecrets([]string{"sk-live-0123456789", "sk-live-0123", "short", "true"})
+
+	assert.Equal(t, "key [REDACTED] and [REDACTED]", r.String("key sk-live-0123456789 and sk-live-0123"),
+		"the longest secret wins")
+	assert.Equal(t, "flag=true name=short", r.String("flag=true name=short"), "short values are not redacted")
+	assert.Equal(t, "token [REDACTED]", r.String("token ghp_abcdEFGH1234"))
+	assert.Equal(t, "password=[REDACTED] user=me", r.String("password=hunter22 user=me"),
+		"only capture groups are redacted")
+
+	r.SetSecrets(nil)
+	assert.Equal(t, "key sk-live-0123456789", r.String("key sk-live-0123456789"))
+
+	var nilRedactor *Redactor
+	assert.Equal(t, "sk-live-0123456789", nilRedactor.String("sk-live-0123456789"))
+
+	_, err = New([]string{"("})
+	assert.ErrorContains(t, err, "invalid redaction pattern")
+}
+
+func TestRedactorValueAndWriter(t *testing.T) {
+	r, err := New(nil)
+	require.NoError(t, err)
+	r.SetSecrets([]string{"s3cr3t-value"})
+
+	value := map[string]interface{}{
+		"env":   []interface{}{"API=s3cr3t-value", 42},
+		"inner": map[string]interface{}{"echo": "s3cr3t-value"},
+	}
+	assert.Equal(t, map[string]interface{}{
+		"env":   []interface{}{"API=[REDACTED]", 42},
+		"inner": map[string]interface{}{"echo": "[REDACTED]"},
+	}, r.Value(value))
+	assert.Equal(t, "s3cr3t-value", value["inner"].(map[string]interface{})["echo"], "the input is not modified")
+
+	var buf bytes.Buffer
+	logger := log.New(r.Writer(&buf), "", 0)
+	logger.Printf("starting with token s3cr3t-value")
+	assert.Equal(t, "starting with token [REDACTED]\n", buf.String())
+}
+
+func TestConfigSecrets(t *testing.T) {
+	secrets := ConfigSecrets(map[string]*config.MCPClientConfigV2{
+		"github": {Env: map[string]string{"GITHUB_TOKEN": "ghp_env_token"}},
+		"remote": {
+			Headers: map[string]string{"Authorization": "Bearer remote-token"},
+			Options: &config.OptionsV2{AuthTokens: []string{"server-auth-token"}},
+		},
+		"missing": nil,
+	}, &config.OptionsV2{AuthTokens: []string{"proxy-auth-token"}})
+
+	assert.ElementsMatch(t, []string{
+		"proxy-auth-token", "ghp_env_token", "Bearer remote-token", "remote-token", "server-auth-token",
+	}, secrets)
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/hierarchy"
+)
+
+// defaultApprovalTimeout bounds the wait for a human decision when approval.timeout is not set
+const defaultApprovalTimeout = 2 * time.Minute
+
+// approvalPayload is what the approval webhook or command receives
+type approvalPayload struct {
+	hierarchy.ApprovalRequest
+	Caller string `json:"caller"`
+}
+
+// hookApprover asks a local webhook or command to approve tool calls
+// MCP elicitation would let the client ask the user directly, but mcp-go does not implement it
+// yet, so approval always goes through the configured hook.
+type hookApprover struct {
+	webhook    string
+	command    []string
+	timeout    time.Duration
+	auth       *authorizer
+	httpClient *http.Client
+}
+
+// newApprovalPolicy builds the approval policy from mcpProxy.options.approval, or returns nil if unset
+// Tools with require_approval in the hierarchy are still rejected when no policy is configured.
+func newApprovalPolicy(options *config.OptionsV2, auth *authorizer) (*hierarchy.ApprovalPolicy, error) {
+	if options == nil || options.Approval == nil {
+		return nil, nil
+	}
+	cfg := options.Approval
+	if cfg.Webhook != "" && len(cfg.Command) > 0 {
+		return nil, errors.New("approval: configure either webhook or command, not both")
+	}
+
+	var approver hierarchy.Approver
+	if cfg.Webhook != "" || len(cfg.Command) > 0 {
+		timeout := cfg.Timeout.Duration()
+		if timeout <= 0 {
+			timeout = defaultApprovalTimeout
+		}
+		approver = &hookApprover{
+			webhook:    cfg.Webhook,
+			command:    cfg.Command,
+			timeout:    timeout,
+			auth:       auth,
+			httpClient: &http.Client{},
+		}
+	}
+
+	policy, err := hierarchy.NewApprovalPolicy(cfg.Tools, cfg.Destructive, approver)
+	if err != nil {
+		return nil, fmt.Errorf("approval: %w", err)
+	}
+	return policy, nil
+}
+
+// Approve sends the pending call to the hook and waits for its decision
+func (a *hookApprover) Approve(ctx context.Context, request hierarchy.ApprovalRequest) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	payload, err := json.Marshal(approvalPayload{ApprovalRequest: request, Caller: a.auth.identity(ctx)})
+	if err != nil {
+		return false, err
+	}
+
+	var approved bool
+	if a.webhook != "" {
+		approved, err = a.askWebhook(ctx, payload)
+	} else {
+		approved, err = a.askCommand(ctx, request, payload)
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return false, fmt.Errorf("no decision within %s", a.timeout)
+	}
+	return approved, err
+}
+
+// askWebhook POSTs the payload and expects a 2xx response with {"approved": true|false}
+func (a *hookApprover) askWebhook(ctx context.Context, payload []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.webhook, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("approval webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, fmt.Errorf("approval webhook returned %s", resp.Status)
+	}
+
+	var decision struct {
+		Approved bool `json:"approved"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return false, fmt.Errorf("approval webhook returned an invalid decision: %w", err)
+	}
+	return decision.Approved, nil
+}
+
+// askCommand runs the command with the payload on stdin; exit status 0 approves the call
+func (a *hookApprover) askCommand(ctx context.Context, request hierarchy.ApprovalRequest, payload []byte) (bool, error) {
+	cmd := exec.CommandContext(ctx, a.command[0], a.command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"MCP_TOOL_PATH="+request.ToolPath,
+		"MCP_SERVER="+request.Server,
+		"MCP_APPROVAL_REASON="+request.Reason,
+	)
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		return false, nil // A non-zero exit status is a rejection
+	}
+	if err != nil {
+		return false, fmt.Errorf("approval command: %w", err)
+	}
+	return true, nil
+}
+
+// approvalMiddleware attaches the approval policy to every tool call for HandleExecuteTool to enforce
+func approvalMiddleware(policy *hierarchy.ApprovalPolicy) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return next(hierarchy.WithApprovalPolicy(ctx, policy), request)
+		}
+	}
+}
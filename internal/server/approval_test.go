@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/hierarchy"
+)
+
+func newTestApprover(t *testing.T, cfg *config.ApprovalConfig) *hookApprover {
+	t.Helper()
+	auth, err := newAuthorizer(&config.OptionsV2{DefaultIdentity: "local"})
+	require.NoError(t, err)
+	return &hookApprover{
+		webhook:    cfg.Webhook,
+		command:    cfg.Command,
+		timeout:    cfg.Timeout.Duration(),
+		auth:       auth,
+		httpClient: &http.Client{},
+	}
+}
+
+func TestApprovalWebhook(t *testing.T) {
+	var received approvalPayload
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		switch received.ToolPath {
+		case "github.merge":
+			w.Write([]byte(`{"approved": true}`))
+		case "github.delete_repo":
+			w.Write([]byte(`{"approved": false}`))
+		default:
+			http.Error(w, "unknown tool", http.StatusInternalServerError)
+		}
+	}))
+	defer hook.Close()
+
+	approver := newTestApprover(t, &config.ApprovalConfig{Webhook: hook.URL, Timeout: config.Duration(time.Second)})
+	ctx := context.Background()
+
+	approved, err := approver.Approve(ctx, hierarchy.ApprovalRequest{ToolPath: "github.merge", Reason: "require_approval"})
+	require.NoError(t, err)
+	assert.True(t, approved)
+	assert.Equal(t, "local", received.Caller)
+	assert.Equal(t, "require_approval", received.Reason)
+
+	approved, err = approver.Approve(ctx, hierarchy.ApprovalRequest{ToolPath: "github.delete_repo"})
+	require.NoError(t, err)
+	assert.False(t, approved)
+
+	_, err = approver.Approve(ctx, hierarchy.ApprovalRequest{ToolPath: "github.other"})
+	assert.ErrorContains(t, err, "500")
+}
+
+func TestApprovalCommand(t *testing.T) {
+	approver := newTestApprover(t, &config.ApprovalConfig{
+		Command: []string{"sh", "-c", `grep -q '"tool_path":"github.merge"' && test "$MCP_TOOL_PATH" = github.merge`},
+		Timeout: config.Duration(5 * time.Second),
+	})
+	ctx := context.Background()
+
+	approved, err := approver.Approve(ctx, hierarchy.ApprovalRequest{ToolPath: "github.merge"})
+	require.NoError(t, err)
+	assert.True(t, approved, "exit status 0 approves")
+
+	approved, err = approver.Approve(ctx, hierarchy.ApprovalRequest{ToolPath: "github.delete_repo"})
+	require.NoError(t, err)
+	assert.False(t, approved, "a non-zero exit status rejects")
+
+	slow := newTestApprover(t, &config.ApprovalConfig{
+		Command: []string{"sleep", "5"},
+		Timeout: config.Duration(50 * time.Millisecond),
+	})
+	_, err = slow.Approve(ctx, hierarchy.ApprovalRequest{ToolPath: "github.merge"})
+	assert.ErrorContains(t, err, "no decision within")
+}
+
+func TestApprovalConfigValidation(t *testing.T) {
+	auth, err := newAuthorizer(nil)
+	require.NoError(t, err)
+
+	policy, err := newApprovalPolicy(&config.OptionsV2{}, auth)
+	require.NoError(t, err)
+	assert.Nil(t, policy)
+
+	_, err = newApprovalPolicy(&config.OptionsV2{Approval: &config.ApprovalConfig{
+		Webhook: "http://localhost:9999", Command: []string{"true"},
+	}}, auth)
+	assert.ErrorContains(t, err, "either webhook or command")
+
+	_, err = newApprovalPolicy(&config.OptionsV2{Approval: &config.ApprovalConfig{Tools: []string{"/[/"}}}, auth)
+	assert.ErrorContains(t, err, "approval:")
+}
+
+func TestProxyAsksForApproval(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStdio, &config.OptionsV2{
+		Approval: &config.ApprovalConfig{Tools: []string{"github.*"}, Command: []string{"false"}},
+	})
+
+	c, err := mcpclient.NewInProcessClient(proxy.MCPServer())
+	require.NoError(t, err)
+	defer c.Close()
+	initializeClient(t, ctx, c)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "execute_tool"
+	request.Params.Arguments = map[string]interface{}{
+		"tool_path": "github.create_issue",
+		"arguments": map[string]interface{}{"title": "Bug"},
+	}
+	_, err = c.CallTool(ctx, request)
+	assert.ErrorContains(t, err, "was rejected")
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/voicetreelab/lazy-mcp/internal/audit"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/hierarchy"
+	"github.com/voicetreelab/lazy-mcp/internal/redact"
+)
+
+// auditor writes an audit record for every call that reaches HandleExecuteTool,
+// through execute_tool or an exposed tool
+type auditor struct {
+	log  *audit.Logger
+	auth *authorizer
+	now  func() time.Time
+}
+
+// newAuditor opens the audit log from mcpProxy.options.audit, or returns nil if unset
+func newAuditor(options *config.OptionsV2, auth *authorizer, redactor *redact.Redactor) (*auditor, error) {
+	if options == nil || options.Audit == nil {
+		return nil, nil
+	}
+	logger, err := audit.Open(options.Audit, redactor)
+	if err != nil {
+		return nil, err
+	}
+	return &auditor{log: logger, auth: auth, now: time.Now}, nil
+}
+
+func (a *auditor) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		exec := hierarchy.ExecutionFromContext(ctx)
+		if exec == nil {
+			exec = &hierarchy.Execution{}
+			ctx = hierarchy.WithExecution(ctx, exec)
+		}
+		started := a.now()
+		result, err := next(ctx, request)
+		if exec.ToolPath == "" {
+			return result, err // Not a tool execution
+		}
+
+		record := audit.Record{
+			Time:       started.UTC(),
+			Caller:     a.auth.identity(ctx),
+			ToolPath:   exec.ToolPath,
+			Server:     exec.Server,
+			MapsTo:     exec.Tool,
+			DurationMs: a.now().Sub(started).Milliseconds(),
+			ErrorClass: errorClass(exec, result, err),
+		}
+		if clientSession := server.ClientSessionFromContext(ctx); clientSession != nil {
+			record.Session = clientSession.SessionID()
+		}
+		if result != nil {
+			if data, marshalErr := json.Marshal(result); marshalErr == nil {
+				record.ResultBytes = len(data)
+			}
+		}
+		if err != nil {
+			record.Error = err.Error()
+		} else if exec.Validation != nil {
+			record.Error = exec.Validation.Error()
+		}
+
+		var arguments map[string]interface{}
+		if request.Params.Name == "execute_tool" {
+			arguments, _ = request.GetArguments()["arguments"].(map[string]interface{})
+		} else {
+			arguments = request.GetArguments()
+		}
+		if logErr := a.log.Log(record, arguments); logErr != nil {
+			log.Printf("Failed to write audit record for %s: %v", exec.ToolPath, logErr)
+		}
+		return result, err
+	}
+}
+
+// errorClass sorts a failed call into a few stable classes that are easy to query
+func errorClass(exec *hierarchy.Execution, result *mcp.CallToolResult, err error) string {
+	var approvalErr *hierarchy.ApprovalDeniedError
+	var timeoutErr *hierarchy.ToolTimeoutError
+	switch {
+	case exec.Validation != nil:
+		return "invalid_arguments"
+	case err == nil && result != nil && result.IsError:
+		return "tool_error"
+	case err == nil:
+		return ""
+	case errors.Is(err, hierarchy.ErrAccessDenied):
+		return "access_denied"
+	case exec.Server == "":
+		return "not_found"
+	case errors.As(err, &approvalErr):
+		return "approval_denied"
+	case errors.As(err, &timeoutErr):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case !exec.Dispatched:
+		return "server_unavailable"
+	default:
+		return "call_failed"
+	}
+}
+
+func (a *auditor) close() {
+	if err := a.log.Close(); err != nil {
+		log.Printf("Failed to close audit log: %v", err)
+	}
+}
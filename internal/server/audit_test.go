@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/audit"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/hierarchy"
+)
+
+func TestProxyWritesAuditLog(t *testing.T) {
+	ctx := context.Background()
+	logPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	proxy := newTestProxy(t, config.MCPServerTypeStdio, &config.OptionsV2{
+		DefaultIdentity: "local",
+		Audit:           &config.AuditConfig{Path: logPath, LogArguments: true},
+	})
+
+	c, err := mcpclient.NewInProcessClient(proxy.MCPServer())
+	require.NoError(t, err)
+	defer c.Close()
+	initializeClient(t, ctx, c)
+
+	execute := func(toolPath string, arguments map[string]interface{}) {
+		request := mcp.CallToolRequest{}
+		request.Params.Name = "execute_tool"
+		request.Params.Arguments = map[string]interface{}{"tool_path": toolPath, "arguments": arguments}
+		result, err := c.CallTool(ctx, request)
+		require.True(t, err != nil || result.IsError, "call to %s should fail", toolPath)
+	}
+
+	// github-mcp does not exist, so even valid calls fail to reach the server
+	execute("github.create_issue", map[string]interface{}{"title": "Bug", "api_token": "s3cret"})
+	execute("github.create_issue", map[string]interface{}{})
+	execute("github.delete_repo", map[string]interface{}{})
+	callTool(t, ctx, c, "get_tools_in_category", map[string]interface{}{"path": "github"})
+
+	records, err := audit.Query(logPath, audit.Filter{}, 0)
+	require.NoError(t, err)
+	require.Len(t, records, 3, "only tool executions are audited")
+
+	first := records[0]
+	assert.Equal(t, "local", first.Caller)
+	assert.Equal(t, "github.create_issue", first.ToolPath)
+	assert.Equal(t, "github", first.Server)
+	assert.Equal(t, "create_issue", first.MapsTo)
+	assert.Equal(t, "server_unavailable", first.ErrorClass)
+	assert.Equal(t, map[string]interface{}{"title": "Bug", "api_token": audit.Redacted}, first.Arguments)
+	assert.Equal(t, audit.Digest(first.Arguments), first.ArgsDigest)
+	assert.NotEmpty(t, first.Error)
+
+	assert.Equal(t, "invalid_arguments", records[1].ErrorClass)
+	assert.Equal(t, "not_found", records[2].ErrorClass)
+}
+
+func TestAuditErrorClass(t *testing.T) {
+	resolved := &hierarchy.Execution{ToolPath: "github.create_issue", Server: "github", Tool: "create_issue"}
+	dispatched := &hierarchy.Execution{ToolPath: "github.create_issue", Server: "github", Tool: "create_issue", Dispatched: true}
+
+	tests := []struct {
+		name   string
+		exec   *hierarchy.Execution
+		result *mcp.CallToolResult
+		err    error
+		want   string
+	}{
+		{"success", dispatched, mcp.NewToolResultText("ok"), nil, ""},
+		{"tool error", dispatched, mcp.NewToolResultError("boom"), nil, "tool_error"},
+		{"access denied", resolved, nil, hierarchy.ErrAccessDenied, "access_denied"},
+		{"approval", resolved, nil, &hierarchy.ApprovalDeniedError{ToolPath: "github.create_issue"}, "approval_denied"},
+		{"timeout", dispatched, nil, &hierarchy.ToolTimeoutError{}, "timeout"},
+		{"canceled", dispatched, nil, context.Canceled, "canceled"},
+		{"start failure", resolved, nil, errors.New("failed to get MCP client"), "server_unavailable"},
+		{"call failure", dispatched, nil, errors.New("connection reset"), "call_failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, errorClass(tt.exec, tt.result, tt.err))
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/hierarchy"
+)
+
+// coldStartBuckets cover everything from a local binary to an npx or uvx download
+var coldStartBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// unknownToolPath labels calls to tool paths that do not resolve, so that clients cannot
+// create a new series with every typo
+const unknownToolPath = "unknown"
+
+// proxyMetrics counts tool executions and server lifecycle events for /metrics
+type proxyMetrics struct {
+	registry      *prometheus.Registry
+	toolCalls     *prometheus.CounterVec
+	toolErrors    *prometheus.CounterVec
+	toolDuration  *prometheus.HistogramVec
+	coldStarts    *prometheus.HistogramVec
+	startFailures *prometheus.CounterVec
+	pingFailures  *prometheus.CounterVec
+}
+
+// newProxyMetrics creates the metrics from mcpProxy.options.metrics, or returns nil if unset
+// It observes the registry, so it must be created before any server is started.
+func newProxyMetrics(options *config.OptionsV2, h *hierarchy.Hierarchy, registry *hierarchy.ServerRegistry) *proxyMetrics {
+	if options == nil || options.Metrics == nil {
+		return nil
+	}
+
+	r := prometheus.NewRegistry()
+	factory := promauto.With(r)
+	m := &proxyMetrics{
+		registry: r,
+		toolCalls: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "lazy_mcp_tool_calls_total", Help: "Tool executions through execute_tool or an exposed tool.",
+		}, []string{"tool_path", "server"}),
+		toolErrors: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "lazy_mcp_tool_errors_total", Help: "Failed tool executions by error class.",
+		}, []string{"server", "class"}),
+		toolDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "lazy_mcp_tool_call_duration_seconds", Help: "Duration of tool executions, including any cold start.",
+		}, []string{"server"}),
+		coldStarts: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "lazy_mcp_server_cold_start_seconds", Help: "Time to start and initialize a server.", Buckets: coldStartBuckets,
+		}, []string{"server"}),
+		startFailures: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "lazy_mcp_server_start_failures_total", Help: "Server startups that failed.",
+		}, []string{"server"}),
+		pingFailures: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "lazy_mcp_server_ping_failures_total", Help: "Failed health check pings of running servers.",
+		}, []string{"server"}),
+	}
+	factory.NewGaugeFunc(prometheus.GaugeOpts{Name: "lazy_mcp_running_servers", Help: "Servers with a running client."}, func() float64 {
+		return float64(registry.RunningCount())
+	})
+	factory.NewGaugeFunc(prometheus.GaugeOpts{Name: "lazy_mcp_hierarchy_nodes", Help: "Nodes in the loaded tool hierarchy."}, func() float64 {
+		return float64(h.NodeCount())
+	})
+	registry.SetObserver(m)
+	return m
+}
+
+// handler serves the metrics in the Prometheus text format
+func (m *proxyMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *proxyMetrics) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		exec := hierarchy.ExecutionFromContext(ctx)
+		if exec == nil {
+			exec = &hierarchy.Execution{}
+			ctx = hierarchy.WithExecution(ctx, exec)
+		}
+		started := time.Now()
+		result, err := next(ctx, request)
+		if exec.ToolPath == "" {
+			return result, err // Not a tool execution
+		}
+
+		// Aliases of a tool share the series of its canonical path
+		toolPath := exec.CanonicalPath
+		if toolPath == "" {
+			toolPath = unknownToolPath
+		}
+		m.toolCalls.WithLabelValues(toolPath, exec.Server).Inc()
+		m.toolDuration.WithLabelValues(exec.Server).Observe(time.Since(started).Seconds())
+		if class := errorClass(exec, result, err); class != "" {
+			m.toolErrors.WithLabelValues(exec.Server, class).Inc()
+		}
+		return result, err
+	}
+}
+
+// ServerStarted implements hierarchy.RegistryObserver
+func (m *proxyMetrics) ServerStarted(serverName string, took time.Duration, err error) {
+	if err != nil {
+		m.startFailures.WithLabelValues(serverName).Inc()
+		return
+	}
+	m.coldStarts.WithLabelValues(serverName).Observe(took.Seconds())
+}
+
+// PingFailed implements hierarchy.RegistryObserver
+func (m *proxyMetrics) PingFailed(serverName string) {
+	m.pingFailures.WithLabelValues(serverName).Inc()
+}
+
+// ServeMetrics serves /metrics on mcpProxy.options.metrics.addr until ctx is done
+// Unlike /metrics next to the MCP endpoint, it does not require an auth token.
+func (p *Proxy) ServeMetrics(ctx context.Context) error {
+	if p.metrics == nil || p.cfg.McpProxy.Options.Metrics.Addr == "" {
+		return errors.New("no metrics address configured")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", p.metrics.handler())
+	httpServer := &http.Server{
+		Addr:    p.cfg.McpProxy.Options.Metrics.Addr,
+		Handler: chainMiddleware(mux, recoverMiddleware("metrics")),
+	}
+
+	log.Printf("Metrics listening on %s/metrics", httpServer.Addr)
+	return listenUntilDone(ctx, httpServer)
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+)
+
+func scrape(t *testing.T, handler http.Handler, token string) (int, string) {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	body, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+	return recorder.Code, string(body)
+}
+
+func TestProxyMetrics(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStreamable, &config.OptionsV2{
+		AuthTokens: []string{"secret"},
+		Metrics:    &config.MetricsConfig{},
+	})
+
+	c, err := mcpclient.NewInProcessClient(proxy.MCPServer())
+	require.NoError(t, err)
+	defer c.Close()
+	initializeClient(t, ctx, c)
+
+	execute := func(toolPath string, arguments map[string]interface{}) {
+		request := mcp.CallToolRequest{}
+		request.Params.Name = "execute_tool"
+		request.Params.Arguments = map[string]interface{}{"tool_path": toolPath, "arguments": arguments}
+		result, err := c.CallTool(ctx, request)
+		require.True(t, err != nil || result.IsError, "call to %s should fail", toolPath)
+	}
+
+	// github-mcp does not exist, so the server fails to start
+	execute("github.create_issue", map[string]interface{}{"title": "Bug"})
+	execute("github.create_issue.create_issue", map[string]interface{}{})
+	execute("github.delete_repo", map[string]interface{}{})
+	execute("typo.anything", map[string]interface{}{})
+	callTool(t, ctx, c, "get_tools_in_category", map[string]interface{}{"path": "github"})
+
+	handler := proxy.sharedMetricsHandler()
+	require.NotNil(t, handler)
+
+	status, _ := scrape(t, handler, "")
+	assert.Equal(t, http.StatusUnauthorized, status, "metrics next to the MCP endpoint need a token")
+
+	status, body := scrape(t, handler, "secret")
+	require.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `lazy_mcp_tool_calls_total{server="github",tool_path="github.create_issue"} 2`+"\n", "aliases count for the canonical path")
+	assert.Contains(t, body, `lazy_mcp_tool_calls_total{server="",tool_path="unknown"} 2`+"\n", "unresolved tool paths share one series")
+	assert.Contains(t, body, `lazy_mcp_tool_errors_total{class="server_unavailable",server="github"} 1`+"\n")
+	assert.Contains(t, body, `lazy_mcp_tool_errors_total{class="invalid_arguments",server="github"} 1`+"\n")
+	assert.Contains(t, body, `lazy_mcp_tool_errors_total{class="not_found",server=""} 2`+"\n")
+	assert.Contains(t, body, `lazy_mcp_tool_call_duration_seconds_count{server="github"} 2`+"\n")
+	assert.Contains(t, body, `lazy_mcp_server_start_failures_total{server="github"} 1`+"\n")
+	assert.Contains(t, body, "lazy_mcp_running_servers 0\n")
+	assert.Contains(t, body, "lazy_mcp_hierarchy_nodes 3\n", "root, github and github.create_issue")
+
+	proxy.metrics.PingFailed("github")
+	proxy.metrics.ServerStarted("github", 1500*time.Millisecond, nil)
+	_, body = scrape(t, handler, "secret")
+	assert.Contains(t, body, `lazy_mcp_server_ping_failures_total{server="github"} 1`+"\n")
+	assert.Contains(t, body, `lazy_mcp_server_cold_start_seconds_bucket{server="github",le="2.5"} 1`+"\n")
+}
+
+func TestProxyServesMetricsOnSeparateAddress(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	proxy := newTestProxy(t, config.MCPServerTypeStreamable, &config.OptionsV2{
+		AuthTokens: []string{"secret"},
+		Metrics:    &config.MetricsConfig{Addr: addr},
+	})
+	proxy.cfg.McpProxy.Addr = "127.0.0.1:0"
+	assert.Nil(t, proxy.sharedMetricsHandler(), "metrics are not served next to the MCP endpoint")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- proxy.Serve(ctx) }()
+
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		resp, err = http.Get("http://" + addr + "/metrics")
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "no token is needed on the metrics address")
+	assert.Contains(t, string(body), "# TYPE lazy_mcp_running_servers gauge\n")
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not stop the metrics listener")
+	}
+}
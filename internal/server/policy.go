@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/hierarchy"
+)
+
+// anyIdentity keys the policy of callers without a policy of their own
+const anyIdentity = "*"
+
+// authorizer names callers and looks up the tool policy that applies to them
+type authorizer struct {
+	labels          map[string]string
+	defaultIdentity string
+
+	// policies is nil when no policies are configured, which leaves every caller unrestricted
+	policies map[string]*hierarchy.AccessPolicy
+	denyAll  *hierarchy.AccessPolicy
+}
+
+func newAuthorizer(options *config.OptionsV2) (*authorizer, error) {
+	a := &authorizer{}
+	if options == nil {
+		return a, nil
+	}
+	a.labels = options.TokenLabels
+	a.defaultIdentity = options.DefaultIdentity
+
+	if len(options.Policies) == 0 {
+		return a, nil
+	}
+	a.policies = make(map[string]*hierarchy.AccessPolicy, len(options.Policies))
+	for identity, rules := range options.Policies {
+		if rules == nil {
+			rules = &config.ToolPolicy{}
+		}
+		policy, err := hierarchy.NewAccessPolicy(rules.Allow, rules.Deny)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy for %s: %w", identity, err)
+		}
+		a.policies[identity] = policy
+	}
+	a.denyAll, _ = hierarchy.NewAccessPolicy(nil, []string{"*"})
+	return a, nil
+}
+
+// identity names the caller for sessions and logs: the label of its token, a fingerprint of
+// the token, or the default identity for callers without one
+func (a *authorizer) identity(ctx context.Context) string {
+	token := callerToken(ctx)
+	if token == "" {
+		if a.defaultIdentity != "" {
+			return a.defaultIdentity
+		}
+		return tokenIdentity("")
+	}
+	if label, ok := a.labels[token]; ok {
+		return label
+	}
+	return tokenIdentity(token)
+}
+
+// policy returns the caller's policy, looked up by token label, token or default identity, then "*"
+// Once policies are configured, a caller none of them applies to may not use any tool.
+func (a *authorizer) policy(ctx context.Context) *hierarchy.AccessPolicy {
+	if a.policies == nil {
+		return nil
+	}
+
+	var keys []string
+	if token := callerToken(ctx); token != "" {
+		if label, ok := a.labels[token]; ok {
+			keys = append(keys, label)
+		}
+		keys = append(keys, token)
+	} else if a.defaultIdentity != "" {
+		keys = append(keys, a.defaultIdentity)
+	}
+	keys = append(keys, anyIdentity)
+
+	for _, key := range keys {
+		if policy, ok := a.policies[key]; ok {
+			return policy
+		}
+	}
+	return a.denyAll
+}
+
+// middleware attaches the caller's policy to every tool call for the hierarchy handlers to enforce
+func (a *authorizer) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return next(hierarchy.WithAccessPolicy(ctx, a.policy(ctx)), request)
+	}
+}
+
+// toolFilter hides the exposed, pinned and promoted tools the caller's policy denies from tools/list
+// Calling them is refused by HandleExecuteTool either way; the meta-tools are always listed.
+func (a *authorizer) toolFilter(h *hierarchy.Hierarchy, direct *directTools) server.ToolFilterFunc {
+	return func(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+		policy := a.policy(ctx)
+		if policy == nil {
+			return tools
+		}
+		allowed := make([]mcp.Tool, 0, len(tools))
+		for _, tool := range tools {
+			if toolPath, ok := direct.path(tool.Name); ok && h.CheckAccess(policy, toolPath) != nil {
+				continue
+			}
+			allowed = append(allowed, tool)
+		}
+		return allowed
+	}
+}
+
+// directTools maps the names of exposed, pinned and promoted tools to their tool paths
+// Names are derived from tool paths, so an entry never goes stale; a tool removed from
+// the hierarchy simply fails CheckAccess.
+type directTools struct {
+	mu    sync.RWMutex
+	paths map[string]string
+}
+
+func newDirectTools() *directTools {
+	return &directTools{paths: make(map[string]string)}
+}
+
+// record remembers that the direct tool name runs the tool at toolPath
+func (d *directTools) record(name, toolPath string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.paths[name] = toolPath
+}
+
+// path returns the tool path of a direct tool, or false for the meta-tools
+func (d *directTools) path(name string) (string, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	toolPath, ok := d.paths[name]
+	return toolPath, ok
+}
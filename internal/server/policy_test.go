@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+)
+
+func TestAuthorizerResolvesPolicies(t *testing.T) {
+	auth, err := newAuthorizer(&config.OptionsV2{
+		TokenLabels:     map[string]string{"ci-token": "ci"},
+		DefaultIdentity: "local",
+		Policies: map[string]*config.ToolPolicy{
+			"ci":        {Allow: []string{"github.*"}},
+			"raw-token": {Deny: []string{"github.*"}},
+			"local":     {},
+		},
+	})
+	require.NoError(t, err)
+
+	ci := withCallerToken(context.Background(), "ci-token")
+	assert.Equal(t, "ci", auth.identity(ci))
+	assert.True(t, auth.policy(ci).Allows("github.create_issue"))
+	assert.False(t, auth.policy(ci).Allows("filesystem.read_file"))
+
+	raw := withCallerToken(context.Background(), "raw-token")
+	assert.Equal(t, tokenIdentity("raw-token"), auth.identity(raw))
+	assert.False(t, auth.policy(raw).Allows("github.create_issue"), "policies can be keyed by the token itself")
+
+	local := context.Background()
+	assert.Equal(t, "local", auth.identity(local))
+	assert.True(t, auth.policy(local).Allows("filesystem.read_file"))
+
+	unknown := withCallerToken(context.Background(), "other-token")
+	assert.False(t, auth.policy(unknown).Allows("github.create_issue"), "callers without a policy are denied")
+
+	_, err = newAuthorizer(&config.OptionsV2{Policies: map[string]*config.ToolPolicy{"*": {Allow: []string{""}}}})
+	assert.Error(t, err)
+
+	unrestricted, err := newAuthorizer(nil)
+	require.NoError(t, err)
+	assert.Nil(t, unrestricted.policy(ci))
+	assert.Equal(t, "anonymous", unrestricted.identity(local))
+}
+
+func TestProxyEnforcesPolicyForDefaultIdentity(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStdio, &config.OptionsV2{
+		DefaultIdentity: "local",
+		Policies: map[string]*config.ToolPolicy{
+			"local": {Deny: []string{"github.create_*"}},
+		},
+	})
+
+	c, err := mcpclient.NewInProcessClient(proxy.MCPServer())
+	require.NoError(t, err)
+	defer c.Close()
+	initializeClient(t, ctx, c)
+
+	result := callTool(t, ctx, c, "get_tools_in_category", map[string]interface{}{"path": ""})
+	assert.NotContains(t, result.Content[0].(mcp.TextContent).Text, "github")
+
+	result = callTool(t, ctx, c, "search_tools", map[string]interface{}{"query": "create issue"})
+	assert.NotContains(t, result.Content[0].(mcp.TextContent).Text, "github.create_issue")
+
+	for _, name := range []string{"describe_tool", "execute_tool"} {
+		request := mcp.CallToolRequest{}
+		request.Params.Name = name
+		request.Params.Arguments = map[string]interface{}{
+			"tool_path": "github.create_issue",
+			"arguments": map[string]interface{}{"title": "Bug"},
+		}
+		_, err = c.CallTool(ctx, request)
+		assert.ErrorContains(t, err, "access denied", name)
+	}
+}
+
+func TestProxyHidesDeniedDirectToolsFromToolsList(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStreamable, &config.OptionsV2{
+		AuthTokens:  []string{"admin-token", "ci-token"},
+		PinnedTools: []string{"github.create_issue"},
+		Policies: map[string]*config.ToolPolicy{
+			"admin-token": {},
+			"ci-token":    {Deny: []string{"github.*"}},
+		},
+	})
+
+	admin := newStreamableTestClient(t, proxy, "admin-token")
+	initializeClient(t, ctx, admin)
+	assert.Contains(t, listToolNames(t, ctx, admin), "github_create_issue")
+
+	ci := newStreamableTestClient(t, proxy, "ci-token")
+	initializeClient(t, ctx, ci)
+	names := listToolNames(t, ctx, ci)
+	assert.NotContains(t, names, "github_create_issue", "pinned tools the caller may not run are not listed")
+	assert.Contains(t, names, "execute_tool")
+}
+
+func TestProxyEnforcesPolicyOnResourcesAndPrompts(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStdio, &config.OptionsV2{
+		DefaultIdentity: "local",
+		Policies: map[string]*config.ToolPolicy{
+			"local": {Deny: []string{"github.*"}},
+		},
+	})
+
+	c, err := mcpclient.NewInProcessClient(proxy.MCPServer())
+	require.NoError(t, err)
+	defer c.Close()
+	initializeClient(t, ctx, c)
+
+	// None of the github tools is allowed, so the server is not started for its resources or prompts either
+	calls := map[string]map[string]interface{}{
+		"list_resources": {"server": "github"},
+		"read_resource":  {"server": "github", "uri": "repo://voicetreelab/lazy-mcp"},
+		"list_prompts":   {"server": "github"},
+		"get_prompt":     {"server": "github", "name": "review_pr"},
+	}
+	for name, arguments := range calls {
+		request := mcp.CallToolRequest{}
+		request.Params.Name = name
+		request.Params.Arguments = arguments
+		_, err = c.CallTool(ctx, request)
+		assert.ErrorContains(t, err, "access denied", name)
+	}
+}
+
+func TestProxyPolicyPerToken(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStreamable, &config.OptionsV2{
+		AuthTokens:  []string{"secret", "readonly"},
+		TokenLabels: map[string]string{"readonly": "viewer"},
+		Policies: map[string]*config.ToolPolicy{
+			"viewer": {Deny: []string{"*"}},
+			"*":      {},
+		},
+	})
+
+	// The first token falls back to "*" and sees the whole tree
+	c := newStreamableTestClient(t, proxy, "secret")
+	initializeClient(t, ctx, c)
+	result := callTool(t, ctx, c, "get_tools_in_category", map[string]interface{}{"path": "github"})
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "create_issue")
+
+	viewer := newStreamableTestClient(t, proxy, "readonly")
+	initializeClient(t, ctx, viewer)
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "get_tools_in_category"
+	request.Params.Arguments = map[string]interface{}{"path": "github"}
+	_, err := viewer.CallTool(ctx, request)
+	assert.ErrorContains(t, err, "category not found")
+}
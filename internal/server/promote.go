@@ -0,0 +1,299 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/hierarchy"
+)
+
+// defaultPromotionTTL applies when promoteTools is set without promotionTurns or promotionTTL
+const defaultPromotionTTL = 10 * time.Minute
+
+// promotedTool is a hierarchy tool currently registered as a direct MCP tool
+type promotedTool struct {
+	toolPath string
+	lastTurn int
+	lastUsed time.Time
+}
+
+// promotionSet is the working set of one client session
+type promotionSet struct {
+	// session holds the promoted tools; nil for the shared set, whose tools are registered server-wide
+	session  server.SessionWithTools
+	turn     int
+	promoted map[string]*promotedTool
+}
+
+// toolPromoter registers the tools an agent discovers or uses as direct MCP tools and ages them out
+// A turn is any tool call in the session. Expiry is checked on every turn, so a working set only
+// changes while its agent is active.
+//
+// SSE and stateful streamable-http sessions each get their own working set as session tools.
+// Clients whose sessions cannot hold tools (stdio, in-process and stateless streamable-http)
+// share one set of server-wide tools.
+type toolPromoter struct {
+	mcpServer *server.MCPServer
+	h         *hierarchy.Hierarchy
+	registry  *hierarchy.ServerRegistry
+	direct    *directTools
+	maxTurns  int
+	ttl       time.Duration
+	now       func() time.Time
+
+	// mu also serializes updates of the session tools, which are read, modified and written back
+	mu   sync.Mutex
+	sets map[string]*promotionSet
+	// static holds the names of exposed and pinned tools, which are never promoted or aged out
+	static map[string]bool
+}
+
+// newToolPromoter returns nil unless options.promoteTools is set
+func newToolPromoter(options *config.OptionsV2, h *hierarchy.Hierarchy, registry *hierarchy.ServerRegistry, direct *directTools) *toolPromoter {
+	if options == nil || !options.PromoteTools.OrElse(false) {
+		return nil
+	}
+
+	p := &toolPromoter{
+		h:        h,
+		registry: registry,
+		direct:   direct,
+		maxTurns: options.PromotionTurns,
+		ttl:      options.PromotionTTL.Duration(),
+		now:      time.Now,
+		sets:     make(map[string]*promotionSet),
+		static:   make(map[string]bool),
+	}
+	if p.maxTurns <= 0 && p.ttl <= 0 {
+		p.ttl = defaultPromotionTTL
+	}
+	return p
+}
+
+// middleware counts turns, refreshes promoted tools when they are called, and promotes tools
+// after a successful get_tools_in_category or execute_tool
+func (p *toolPromoter) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		set := p.sessionSet(ctx)
+		p.beginTurn(set, request.Params.Name)
+
+		result, err := next(ctx, request)
+		if err != nil || (result != nil && result.IsError) {
+			return result, err
+		}
+
+		// Only tools the caller may use are promoted
+		policy := hierarchy.AccessPolicyFromContext(ctx)
+		switch request.Params.Name {
+		case "get_tools_in_category":
+			p.promoteCategory(set, request.GetString("path", ""), policy)
+		case "execute_tool":
+			if _, serverName, resolveErr := p.h.ResolveToolPath(request.GetString("tool_path", "")); resolveErr == nil && serverName != "" {
+				var allowed []string
+				for _, toolPath := range p.h.ServerToolPaths(serverName) {
+					if policy.Allows(toolPath) {
+						allowed = append(allowed, toolPath)
+					}
+				}
+				p.promote(set, allowed)
+			}
+		}
+		return result, err
+	}
+}
+
+// sessionSet returns the working set of the caller's session, creating it on first use
+func (p *toolPromoter) sessionSet(ctx context.Context) *promotionSet {
+	var key string
+	var session server.SessionWithTools
+	if clientSession := server.ClientSessionFromContext(ctx); clientSession != nil && clientSession.SessionID() != "" {
+		if withTools, ok := clientSession.(server.SessionWithTools); ok {
+			key, session = clientSession.SessionID(), withTools
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	set, ok := p.sets[key]
+	if !ok {
+		set = &promotionSet{session: session, promoted: make(map[string]*promotedTool)}
+		p.sets[key] = set
+	}
+	return set
+}
+
+// beginTurn advances the turn counter of a set, marks a promoted tool as used, and removes expired tools
+func (p *toolPromoter) beginTurn(set *promotionSet, toolName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	set.turn++
+	now := p.now()
+	if promoted, ok := set.promoted[toolName]; ok {
+		promoted.lastTurn = set.turn
+		promoted.lastUsed = now
+	}
+
+	var expired []string
+	for name, promoted := range set.promoted {
+		if (p.maxTurns > 0 && set.turn-promoted.lastTurn > p.maxTurns) || (p.ttl > 0 && now.Sub(promoted.lastUsed) > p.ttl) {
+			expired = append(expired, name)
+			delete(set.promoted, name)
+		}
+	}
+
+	if len(expired) > 0 {
+		log.Printf("Demoting %d unused tools: %v", len(expired), expired)
+		p.apply(set, nil, expired)
+	}
+}
+
+// promoteCategory promotes the tools listed by get_tools_in_category for path
+func (p *toolPromoter) promoteCategory(set *promotionSet, path string, policy *hierarchy.AccessPolicy) {
+	response, err := p.h.HandleGetToolsInCategoryWithOptions(path, hierarchy.CategoryOptions{Policy: policy})
+	if err != nil {
+		return
+	}
+	tools, _ := response["tools"].(map[string]interface{})
+
+	toolPaths := make([]string, 0, len(tools))
+	for _, info := range tools {
+		if toolInfo, ok := info.(map[string]interface{}); ok {
+			if toolPath, ok := toolInfo["tool_path"].(string); ok {
+				toolPaths = append(toolPaths, toolPath)
+			}
+		}
+	}
+	p.promote(set, toolPaths)
+}
+
+// promote registers the given tools as direct MCP tools of the set, or refreshes them if already promoted
+// A single tools/list_changed notification is sent for newly promoted tools.
+func (p *toolPromoter) promote(set *promotionSet, toolPaths []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	var added []server.ServerTool
+	for _, toolPath := range toolPaths {
+		name := hierarchy.ExposedToolName(toolPath)
+		if p.static[name] || metaToolNames[name] {
+			continue
+		}
+		if promoted, ok := set.promoted[name]; ok {
+			promoted.lastTurn = set.turn
+			promoted.lastUsed = now
+			continue
+		}
+
+		toolDef, serverName, err := p.h.ResolveToolPath(toolPath)
+		if err != nil || serverName == "" {
+			continue
+		}
+		exposedTool := hierarchy.ExposedTool{Name: name, ToolPath: toolPath, Tool: toolDef}
+		added = append(added, server.ServerTool{
+			Tool:    exposedMCPTool(exposedTool),
+			Handler: exposedToolHandler(p.h, p.registry, toolPath),
+		})
+		p.direct.record(name, toolPath)
+		set.promoted[name] = &promotedTool{toolPath: toolPath, lastTurn: set.turn, lastUsed: now}
+	}
+
+	if len(added) > 0 {
+		log.Printf("Promoting %d tools to direct MCP tools", len(added))
+		p.apply(set, added, nil)
+	}
+}
+
+// apply registers added and removes the named tools, on the set's session or server-wide
+// Must be called with p.mu held.
+func (p *toolPromoter) apply(set *promotionSet, added []server.ServerTool, removed []string) {
+	if set.session == nil {
+		if len(removed) > 0 {
+			p.mcpServer.DeleteTools(removed...)
+		}
+		if len(added) > 0 {
+			p.mcpServer.AddTools(added...)
+		}
+		return
+	}
+
+	// MCPServer.AddSessionTools only knows registered sessions, but a streamable-http session only
+	// exists for the duration of each request. The tools are set on the session itself instead;
+	// its tool store is keyed by session ID and outlives the request.
+	tools := make(map[string]server.ServerTool)
+	for name, tool := range set.session.GetSessionTools() {
+		tools[name] = tool
+	}
+	for _, name := range removed {
+		delete(tools, name)
+	}
+	for _, tool := range added {
+		tools[tool.Tool.Name] = tool
+	}
+	set.session.SetSessionTools(tools)
+	// Clients without a notification stream find out on their next tools/list
+	_ = p.mcpServer.SendNotificationToSpecificClient(set.session.SessionID(), mcp.MethodNotificationToolsListChanged, nil)
+}
+
+// setStatic records the exposed and pinned tool names; promoted tools that became static stop ageing
+func (p *toolPromoter) setStatic(names []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.static = make(map[string]bool, len(names))
+	for _, name := range names {
+		p.static[name] = true
+	}
+	for _, set := range p.sets {
+		var removed []string
+		for name := range set.promoted {
+			if p.static[name] {
+				removed = append(removed, name)
+				delete(set.promoted, name)
+			}
+		}
+		// The shared set must not delete the server-wide tool that now exposes the same name
+		if len(removed) > 0 && set.session != nil {
+			p.apply(set, nil, removed)
+		}
+	}
+}
+
+// dropUnresolved demotes promoted tools whose tool path no longer resolves, e.g. after a hierarchy reload
+func (p *toolPromoter) dropUnresolved() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, set := range p.sets {
+		var removed []string
+		for name, promoted := range set.promoted {
+			if _, serverName, err := p.h.ResolveToolPath(promoted.toolPath); err != nil || serverName == "" {
+				removed = append(removed, name)
+				delete(set.promoted, name)
+			}
+		}
+		if len(removed) > 0 {
+			log.Printf("Demoting %d tools removed from the hierarchy: %v", len(removed), removed)
+			p.apply(set, nil, removed)
+		}
+	}
+}
+
+// forget drops the working set of a session that ended
+func (p *toolPromoter) forget(sessionID string) {
+	if sessionID == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if set, ok := p.sets[sessionID]; ok {
+		set.session.SetSessionTools(nil)
+		delete(p.sets, sessionID)
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TBXark/optional-go"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+)
+
+func listToolNames(t *testing.T, ctx context.Context, c *mcpclient.Client) []string {
+	t.Helper()
+	tools, err := c.ListTools(ctx, mcp.ListToolsRequest{})
+	require.NoError(t, err)
+	names := make([]string, 0, len(tools.Tools))
+	for _, tool := range tools.Tools {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+func TestToolPromotionByTurns(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStdio, &config.OptionsV2{
+		PromoteTools:   optional.NewField(true),
+		PromotionTurns: 2,
+	})
+
+	c, err := mcpclient.NewInProcessClient(proxy.MCPServer())
+	require.NoError(t, err)
+	defer c.Close()
+	initializeClient(t, ctx, c)
+
+	assert.NotContains(t, listToolNames(t, ctx, c), "github_create_issue")
+
+	// Browsing a leaf category promotes its tools
+	callTool(t, ctx, c, "get_tools_in_category", map[string]interface{}{"path": "github"})
+	assert.Contains(t, listToolNames(t, ctx, c), "github_create_issue")
+
+	// Unused for more than two turns: demoted
+	for i := 0; i < 3; i++ {
+		callTool(t, ctx, c, "search_tools", map[string]interface{}{"query": "issue"})
+	}
+	assert.NotContains(t, listToolNames(t, ctx, c), "github_create_issue")
+}
+
+func TestToolPromotionByTTL(t *testing.T) {
+	proxy := newTestProxy(t, config.MCPServerTypeStdio, nil)
+	now := time.Now()
+	promoter := newToolPromoter(&config.OptionsV2{PromoteTools: optional.NewField(true)}, proxy.hierarchy, proxy.registry, newDirectTools())
+	require.NotNil(t, promoter)
+	promoter.mcpServer = server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(true))
+	promoter.now = func() time.Time { return now }
+	set := promoter.sessionSet(context.Background())
+
+	promoter.promote(set, []string{"github.create_issue"})
+	assert.Contains(t, set.promoted, "github_create_issue")
+
+	// Using the tool keeps it promoted
+	now = now.Add(defaultPromotionTTL - time.Minute)
+	promoter.beginTurn(set, "github_create_issue")
+	now = now.Add(defaultPromotionTTL - time.Minute)
+	promoter.beginTurn(set, "search_tools")
+	assert.Contains(t, set.promoted, "github_create_issue")
+
+	now = now.Add(2 * time.Minute)
+	promoter.beginTurn(set, "search_tools")
+	assert.NotContains(t, set.promoted, "github_create_issue")
+}
+
+func TestToolPromotionSkipsPinnedTools(t *testing.T) {
+	proxy := newTestProxy(t, config.MCPServerTypeStdio, nil)
+	promoter := newToolPromoter(&config.OptionsV2{PromoteTools: optional.NewField(true), PromotionTurns: 1}, proxy.hierarchy, proxy.registry, newDirectTools())
+	promoter.mcpServer = server.NewMCPServer("test", "1.0.0")
+	promoter.setStatic([]string{"github_create_issue"})
+	set := promoter.sessionSet(context.Background())
+
+	promoter.promote(set, []string{"github.create_issue"})
+	assert.Empty(t, set.promoted, "pinned tools are never promoted, so they never age out")
+
+	assert.Nil(t, newToolPromoter(&config.OptionsV2{}, proxy.hierarchy, proxy.registry, newDirectTools()), "promotion is opt-in")
+}
+
+func TestToolPromotionIsPerSession(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStreamable, &config.OptionsV2{
+		AuthTokens:       []string{"secret"},
+		StatefulSessions: optional.NewField(true),
+		PromoteTools:     optional.NewField(true),
+	})
+
+	first := newStreamableTestClient(t, proxy, "secret")
+	initializeClient(t, ctx, first)
+	second := newStreamableTestClient(t, proxy, "secret")
+	initializeClient(t, ctx, second)
+
+	callTool(t, ctx, first, "get_tools_in_category", map[string]interface{}{"path": "github"})
+	assert.Contains(t, listToolNames(t, ctx, first), "github_create_issue")
+	assert.NotContains(t, listToolNames(t, ctx, second), "github_create_issue", "promotions stay in the session that made them")
+
+	// Ending the session drops its working set
+	sessionID := first.GetSessionId()
+	proxy.sessions.remove(sessionID)
+	assert.NotContains(t, proxy.sessions.sessions, sessionID)
+}
+
+func TestToolPromotionDropsToolsRemovedByReload(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStdio, nil)
+	promoter := newToolPromoter(&config.OptionsV2{PromoteTools: optional.NewField(true)}, proxy.hierarchy, proxy.registry, newDirectTools())
+	promoter.mcpServer = proxy.MCPServer()
+
+	c, err := mcpclient.NewInProcessClient(proxy.MCPServer())
+	require.NoError(t, err)
+	defer c.Close()
+	initializeClient(t, ctx, c)
+
+	set := promoter.sessionSet(ctx)
+	promoter.promote(set, []string{"github.create_issue"})
+	assert.Contains(t, listToolNames(t, ctx, c), "github_create_issue")
+
+	require.NoError(t, os.Remove(filepath.Join(proxy.cfg.McpProxy.HierarchyPath, "github", "create_issue.json")))
+	require.NoError(t, proxy.hierarchy.Reload())
+	promoter.dropUnresolved()
+
+	assert.Empty(t, set.promoted)
+	assert.NotContains(t, listToolNames(t, ctx, c), "github_create_issue")
+}
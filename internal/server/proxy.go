@@ -0,0 +1,426 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/hierarchy"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Proxy is the hierarchical MCP proxy: one MCP server exposing the meta-tools
+// over the tool hierarchy, backed by lazily loaded MCP servers.
+// It can be served over stdio or HTTP, or driven in-process through MCPServer.
+type Proxy struct {
+	cfg       *config.Config
+	hierarchy *hierarchy.Hierarchy
+	registry  *hierarchy.ServerRegistry
+	mcpServer *server.MCPServer
+	sessions  *sessionStore
+	auditor   *auditor
+	tracer    *sdktrace.TracerProvider
+	metrics   *proxyMetrics
+
+	// logOutput is the log output to restore on Close when the log is redacted
+	logOutput io.Writer
+
+	// ctx lives until Close and stops the hierarchy watcher
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewHierarchicalProxy loads the hierarchy, creates the server registry and registers the meta-tools
+// Servers marked with preload are started in the background; all others stay lazy.
+// Optional features such as metrics, redaction, tracing, approval, auditing and tool promotion are
+// only installed when their option is set.
+func NewHierarchicalProxy(cfg *config.Config) (*Proxy, error) {
+	// Load hierarchy from filesystem
+	log.Printf("Loading hierarchy from %s", cfg.McpProxy.HierarchyPath)
+	// The toolFilter of servers in config.json prunes their tools from the hierarchy too
+	h, err := hierarchy.LoadHierarchyWithServers(cfg.McpProxy.HierarchyPath, cfg.McpServers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load hierarchy: %w", err)
+	}
+
+	// Create server registry for lazy-loaded MCP clients
+	// Servers come from config.json plus any mcp_server blocks in the hierarchy
+	serverConfigs := hierarchy.MergeServerConfigs(cfg.McpServers, h.ServerConfigs(), cfg.McpProxy.Options)
+	registry := hierarchy.NewServerRegistry(serverConfigs)
+
+	// Count tool calls and server startups for /metrics, including preloads
+	proxyMetrics := newProxyMetrics(cfg.McpProxy.Options, h, registry)
+
+	// Create ONE MCP server with the meta-tools
+	serverOpts := []server.ServerOption{
+		server.WithResourceCapabilities(true, true),
+		server.WithToolCapabilities(true),
+		server.WithRecovery(),
+	}
+
+	if cfg.McpProxy.Options != nil && cfg.McpProxy.Options.LogEnabled.OrElse(false) {
+		serverOpts = append(serverOpts, server.WithLogging())
+	}
+
+	// Scrub secrets from everything a tool call returns, and from the log
+	redactor, err := newRedactor(cfg.McpProxy.Options, serverConfigs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Trace tool calls through the proxy into the downstream servers
+	tracer, err := newTracer(cfg.McpProxy.Options, redactor)
+	if err != nil {
+		return nil, err
+	}
+	if tracer != nil {
+		serverOpts = append(serverOpts, server.WithToolHandlerMiddleware(tracingMiddleware(tracer)))
+	}
+	if redactor != nil {
+		serverOpts = append(serverOpts, server.WithToolHandlerMiddleware(redactMiddleware(redactor)))
+	}
+
+	// Resolve the caller's tool policy before the middlewares that act on the call
+	// Tracing and redaction wrap it, so denied calls are traced and their errors redacted too.
+	auth, err := newAuthorizer(cfg.McpProxy.Options)
+	if err != nil {
+		return nil, err
+	}
+	serverOpts = append(serverOpts, server.WithToolHandlerMiddleware(auth.middleware))
+
+	// Direct tools the caller's policy denies are left out of tools/list
+	direct := newDirectTools()
+	if auth.policies != nil {
+		serverOpts = append(serverOpts, server.WithToolFilter(auth.toolFilter(h, direct)))
+	}
+
+	// Sensitive tool calls wait for a human decision
+	approval, err := newApprovalPolicy(cfg.McpProxy.Options, auth)
+	if err != nil {
+		return nil, err
+	}
+	serverOpts = append(serverOpts, server.WithToolHandlerMiddleware(approvalMiddleware(approval)))
+
+	// Track client sessions; stdio and SSE sessions last as long as their connection
+	sessions := newSessionStore(cfg.McpProxy.Options, auth)
+	hooks := &server.Hooks{}
+	hooks.AddOnRegisterSession(func(ctx context.Context, session server.ClientSession) {
+		sessions.connect(session.SessionID())
+	})
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		sessions.remove(session.SessionID())
+	})
+	hooks.AddAfterInitialize(sessions.afterInitialize)
+	serverOpts = append(serverOpts, server.WithHooks(hooks), server.WithToolHandlerMiddleware(sessions.middleware))
+
+	if proxyMetrics != nil {
+		serverOpts = append(serverOpts, server.WithToolHandlerMiddleware(proxyMetrics.middleware))
+	}
+
+	// Append every tool execution to the audit log
+	auditor, err := newAuditor(cfg.McpProxy.Options, auth, redactor)
+	if err != nil {
+		return nil, err
+	}
+	if auditor != nil {
+		serverOpts = append(serverOpts, server.WithToolHandlerMiddleware(auditor.middleware))
+	}
+
+	// Promote discovered tools to direct MCP tools
+	promoter := newToolPromoter(cfg.McpProxy.Options, h, registry, direct)
+	if promoter != nil {
+		serverOpts = append(serverOpts, server.WithToolHandlerMiddleware(promoter.middleware))
+	}
+
+	mcpServer := server.NewMCPServer(
+		cfg.McpProxy.Name,
+		cfg.McpProxy.Version,
+		serverOpts...,
+	)
+	if promoter != nil {
+		promoter.mcpServer = mcpServer
+		sessions.onEnd = promoter.forget
+	}
+
+	addGetToolsInCategory(mcpServer, h)
+	addExecuteTool(mcpServer, h, registry)
+	addDescribeTool(mcpServer, h)
+	addSearchTools(mcpServer, h)
+	addResourceTools(mcpServer, h, registry)
+	addPromptTools(mcpServer, h, registry)
+
+	var pinned []string
+	if cfg.McpProxy.Options != nil {
+		pinned = cfg.McpProxy.Options.PinnedTools
+	}
+	exposed := syncExposedTools(mcpServer, h, registry, direct, pinned, nil)
+	if promoter != nil {
+		promoter.setStatic(exposed)
+	}
+
+	// Redact the log before any server starts, so nothing it prints about its config leaks
+	var logOutput io.Writer
+	if redactor != nil {
+		logOutput = log.Writer()
+		log.SetOutput(redactor.Writer(logOutput))
+	}
+
+	// Warm up servers marked with preload, all others stay lazy
+	registry.Preload()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watchHierarchy(ctx, cfg, mcpServer, h, registry, exposed, direct, promoter, redactor)
+	go sessions.run(ctx)
+
+	return &Proxy{
+		cfg:       cfg,
+		hierarchy: h,
+		registry:  registry,
+		mcpServer: mcpServer,
+		sessions:  sessions,
+		auditor:   auditor,
+		tracer:    tracer,
+		metrics:   proxyMetrics,
+		logOutput: logOutput,
+		ctx:       ctx,
+		cancel:    cancel,
+	}, nil
+}
+
+// MCPServer returns the underlying MCP server, e.g. for an in-process client
+func (p *Proxy) MCPServer() *server.MCPServer {
+	return p.mcpServer
+}
+
+// Serve runs every front-end transport configured in mcpProxy (transports, or type) over the
+// shared hierarchy and server pool, and the metrics listener if it has its own address.
+// It returns when ctx is done or when any front-end stops, e.g. because the stdio client
+// closed its input; the other front-ends are then shut down too.
+func (p *Proxy) Serve(ctx context.Context) error {
+	serveStdio, httpTypes, err := p.frontEnds()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	running := 0
+	errs := make(chan error, 3)
+	if serveStdio {
+		running++
+		go func() { errs <- p.ServeStdio(ctx) }()
+	}
+	if len(httpTypes) > 0 {
+		running++
+		go func() { errs <- p.ServeHTTP(ctx) }()
+	}
+	if p.metrics != nil && p.cfg.McpProxy.Options.Metrics.Addr != "" {
+		running++
+		go func() { errs <- p.ServeMetrics(ctx) }()
+	}
+
+	// The first front-end to stop takes the others down with it
+	err = <-errs
+	cancel()
+	for i := 1; i < running; i++ {
+		if otherErr := <-errs; err == nil {
+			err = otherErr
+		}
+	}
+	return err
+}
+
+// ServeStdio serves the proxy on stdin/stdout until stdin is closed or ctx is done
+func (p *Proxy) ServeStdio(ctx context.Context) error {
+	log.Printf("Starting hierarchical MCP proxy (stdio server)")
+	err := server.NewStdioServer(p.mcpServer).Listen(ctx, os.Stdin, os.Stdout)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// Handler returns the HTTP handler for the configured HTTP front-ends, wrapped in the proxy middlewares
+// A single HTTP transport is served from the root as before. When both sse and streamable-http are
+// configured, SSE is served on /sse and /message and streamable HTTP on /mcp.
+func (p *Proxy) Handler() (http.Handler, error) {
+	cfg := p.cfg
+
+	_, httpTypes, err := p.frontEnds()
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up HTTP handler (SSE or Streamable)
+	var handler http.Handler
+	switch len(httpTypes) {
+	case 0:
+		return nil, errors.New("no HTTP transport configured")
+	case 1:
+		handler = p.transportHandler(httpTypes[0])
+	default:
+		mux := http.NewServeMux()
+		sseHandler := p.transportHandler(config.MCPServerTypeSSE)
+		mux.Handle("/sse", sseHandler)
+		mux.Handle("/message", sseHandler)
+		mux.Handle("/mcp", p.transportHandler(config.MCPServerTypeStreamable))
+		handler = mux
+	}
+
+	// Apply middleware
+	middlewares := make([]MiddlewareFunc, 0)
+	middlewares = append(middlewares, recoverMiddleware("mcp-proxy"))
+	if p.tracer != nil {
+		middlewares = append(middlewares, traceContextMiddleware)
+	}
+	if cfg.McpProxy.Options != nil && cfg.McpProxy.Options.LogEnabled.OrElse(false) {
+		middlewares = append(middlewares, loggerMiddleware("mcp-proxy"))
+	}
+	if cfg.McpProxy.Options != nil && len(cfg.McpProxy.Options.AuthTokens) > 0 {
+		middlewares = append(middlewares, newAuthMiddleware(cfg.McpProxy.Options.AuthTokens))
+	}
+	return chainMiddleware(handler, middlewares...), nil
+}
+
+// transportHandler returns the mcp-go HTTP server of one transport type
+func (p *Proxy) transportHandler(serverType config.MCPServerType) http.Handler {
+	if serverType == config.MCPServerTypeSSE {
+		return server.NewSSEServer(
+			p.mcpServer,
+			server.WithStaticBasePath(""),
+			server.WithBaseURL(p.cfg.McpProxy.BaseURL),
+		)
+	}
+	if p.cfg.McpProxy.Options != nil && p.cfg.McpProxy.Options.StatefulSessions.OrElse(false) {
+		return server.NewStreamableHTTPServer(
+			p.mcpServer,
+			server.WithSessionIdManager(p.sessions),
+		)
+	}
+	return server.NewStreamableHTTPServer(
+		p.mcpServer,
+		server.WithStateLess(true),
+	)
+}
+
+// frontEnds validates the configured transports and splits them into stdio and HTTP
+func (p *Proxy) frontEnds() (bool, []config.MCPServerType, error) {
+	serveStdio := false
+	var httpTypes []config.MCPServerType
+	for _, serverType := range p.cfg.McpProxy.FrontEnds() {
+		switch serverType {
+		case config.MCPServerTypeStdio:
+			serveStdio = true
+		case config.MCPServerTypeSSE, config.MCPServerTypeStreamable:
+			if !slices.Contains(httpTypes, serverType) {
+				httpTypes = append(httpTypes, serverType)
+			}
+		default:
+			return false, nil, fmt.Errorf("unknown server type: %s", serverType)
+		}
+	}
+	return serveStdio, httpTypes, nil
+}
+
+// ServeHTTP listens on mcpProxy.addr until ctx is done, then shuts the HTTP server down gracefully
+// Unlike http.Handler.ServeHTTP it owns the listener; use Handler to mount the proxy elsewhere.
+func (p *Proxy) ServeHTTP(ctx context.Context) error {
+	handler, err := p.Handler()
+	if err != nil {
+		return err
+	}
+
+	// Start HTTP server
+	httpMux := http.NewServeMux()
+	httpMux.Handle("/", handler)
+	if metricsHandler := p.sharedMetricsHandler(); metricsHandler != nil {
+		httpMux.Handle("/metrics", metricsHandler)
+	}
+
+	httpServer := &http.Server{
+		Addr:    p.cfg.McpProxy.Addr,
+		Handler: httpMux,
+	}
+
+	log.Printf("Starting hierarchical MCP proxy (%s server)", p.httpTypesLabel())
+	log.Printf("%s server listening on %s", p.httpTypesLabel(), p.cfg.McpProxy.Addr)
+	return listenUntilDone(ctx, httpServer)
+}
+
+// sharedMetricsHandler returns the /metrics handler to mount next to the MCP endpoint, behind
+// the same auth tokens, or nil when metrics are off or served on their own address
+func (p *Proxy) sharedMetricsHandler() http.Handler {
+	if p.metrics == nil || p.cfg.McpProxy.Options.Metrics.Addr != "" {
+		return nil
+	}
+	middlewares := []MiddlewareFunc{recoverMiddleware("metrics")}
+	if tokens := p.cfg.McpProxy.Options.AuthTokens; len(tokens) > 0 {
+		middlewares = append(middlewares, newAuthMiddleware(tokens))
+	}
+	return chainMiddleware(p.metrics.handler(), middlewares...)
+}
+
+// listenUntilDone serves httpServer until ctx is done, then shuts it down gracefully
+func listenUntilDone(ctx context.Context, httpServer *http.Server) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("failed to start server: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+
+	err := httpServer.Shutdown(shutdownCtx)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// httpTypesLabel names the HTTP front-ends for log messages (e.g. "sse+streamable-http")
+func (p *Proxy) httpTypesLabel() string {
+	_, httpTypes, _ := p.frontEnds()
+	labels := make([]string, 0, len(httpTypes))
+	for _, serverType := range httpTypes {
+		labels = append(labels, string(serverType))
+	}
+	return strings.Join(labels, "+")
+}
+
+// Close stops the hierarchy watcher and every running MCP server
+func (p *Proxy) Close() {
+	p.cancel()
+	p.registry.Close()
+	if p.auditor != nil {
+		p.auditor.close()
+	}
+	if p.tracer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := p.tracer.Shutdown(ctx); err != nil {
+			log.Printf("Failed to export the last spans: %v", err)
+		}
+	}
+	if p.logOutput != nil {
+		log.SetOutput(p.logOutput)
+	}
+}
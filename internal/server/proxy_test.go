@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+)
+
+func newTestProxy(t *testing.T, serverType config.MCPServerType, options *config.OptionsV2) *Proxy {
+	t.Helper()
+	dir := t.TempDir()
+	nodes := map[string]string{
+		"root.json":                                  `{"overview": "Test tools", "categories": {"github": "GitHub tools"}}`,
+		filepath.Join("github", "github.json"):       `{"overview": "GitHub", "mcp_server": {"name": "github", "command": "github-mcp"}}`,
+		filepath.Join("github", "create_issue.json"): `{"tools": {"create_issue": {"description": "Create a GitHub issue", "inputSchema": {"type": "object", "required": ["title"]}}}}`,
+	}
+	for name, content := range nodes {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	proxy, err := NewHierarchicalProxy(&config.Config{
+		McpProxy: &config.MCPProxyConfigV2{
+			Name:          "test-proxy",
+			Version:       "1.0.0",
+			Type:          serverType,
+			HierarchyPath: dir,
+			Options:       options,
+		},
+		McpServers: map[string]*config.MCPClientConfigV2{},
+	})
+	require.NoError(t, err)
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+func initializeClient(t *testing.T, ctx context.Context, c *mcpclient.Client) {
+	t.Helper()
+	require.NoError(t, c.Start(ctx))
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = mcp.Implementation{Name: "proxy-test"}
+	_, err := c.Initialize(ctx, initRequest)
+	require.NoError(t, err)
+}
+
+func callTool(t *testing.T, ctx context.Context, c *mcpclient.Client, name string, arguments map[string]interface{}) *mcp.CallToolResult {
+	t.Helper()
+	request := mcp.CallToolRequest{}
+	request.Params.Name = name
+	request.Params.Arguments = arguments
+	result, err := c.CallTool(ctx, request)
+	require.NoError(t, err)
+	return result
+}
+
+func TestProxyInProcess(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStdio, nil)
+
+	c, err := mcpclient.NewInProcessClient(proxy.MCPServer())
+	require.NoError(t, err)
+	defer c.Close()
+	initializeClient(t, ctx, c)
+
+	t.Run("lists only the meta-tools", func(t *testing.T) {
+		tools, err := c.ListTools(ctx, mcp.ListToolsRequest{})
+		require.NoError(t, err)
+
+		var names []string
+		for _, tool := range tools.Tools {
+			names = append(names, tool.Name)
+		}
+		assert.ElementsMatch(t, []string{
+			"get_tools_in_category", "execute_tool", "describe_tool", "search_tools",
+			"list_resources", "read_resource", "list_prompts", "get_prompt",
+		}, names)
+	})
+
+	t.Run("navigates the hierarchy", func(t *testing.T) {
+		result := callTool(t, ctx, c, "get_tools_in_category", map[string]interface{}{"path": "github"})
+		require.False(t, result.IsError)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &response))
+		assert.Contains(t, response["tools"], "create_issue")
+	})
+
+	t.Run("execute_tool validates before starting the server", func(t *testing.T) {
+		request := mcp.CallToolRequest{}
+		request.Params.Name = "execute_tool"
+		request.Params.Arguments = map[string]interface{}{
+			"tool_path": "github.create_issue",
+			"arguments": map[string]interface{}{},
+		}
+		result, err := c.CallTool(ctx, request)
+		require.NoError(t, err)
+		require.True(t, result.IsError)
+		assert.Contains(t, result.Content[0].(mcp.TextContent).Text, `missing required property \"title\"`)
+	})
+}
+
+func TestProxyExposesPinnedTools(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStdio, &config.OptionsV2{PinnedTools: []string{"github.create_issue"}})
+
+	c, err := mcpclient.NewInProcessClient(proxy.MCPServer())
+	require.NoError(t, err)
+	defer c.Close()
+	initializeClient(t, ctx, c)
+
+	tools, err := c.ListTools(ctx, mcp.ListToolsRequest{})
+	require.NoError(t, err)
+
+	var pinned *mcp.Tool
+	for i := range tools.Tools {
+		if tools.Tools[i].Name == "github_create_issue" {
+			pinned = &tools.Tools[i]
+		}
+	}
+	require.NotNil(t, pinned, "pinned tool is listed next to the meta-tools")
+	assert.Equal(t, "Create a GitHub issue", pinned.Description)
+	assert.Equal(t, []string{"title"}, pinned.InputSchema.Required)
+
+	// Calls go through execute_tool, including argument validation
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "github_create_issue"
+	request.Params.Arguments = map[string]interface{}{}
+	result, err := c.CallTool(ctx, request)
+	require.NoError(t, err)
+	require.True(t, result.IsError)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, `missing required property \"title\"`)
+}
+
+func TestProxySkipsExposedToolsNamedLikeMetaTools(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStdio, nil)
+	node := `{"mcp_server": {"name": "search", "command": "search-mcp"}, "tools": {"tools": {"description": "Upstream search"}}}`
+	require.NoError(t, os.MkdirAll(filepath.Join(proxy.cfg.McpProxy.HierarchyPath, "search"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(proxy.cfg.McpProxy.HierarchyPath, "search", "search.json"), []byte(node), 0644))
+	require.NoError(t, proxy.hierarchy.Reload())
+
+	// "search.tools" would be exposed as search_tools
+	exposed := syncExposedTools(proxy.mcpServer, proxy.hierarchy, proxy.registry, newDirectTools(), []string{"search.tools", "github.create_issue"}, nil)
+	assert.Equal(t, []string{"github_create_issue"}, exposed)
+
+	c, err := mcpclient.NewInProcessClient(proxy.MCPServer())
+	require.NoError(t, err)
+	defer c.Close()
+	initializeClient(t, ctx, c)
+
+	result := callTool(t, ctx, c, "search_tools", map[string]interface{}{"query": "issue"})
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "github.create_issue", "the meta-tool is still registered")
+}
+
+func TestProxyHTTPHandler(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStreamable, &config.OptionsV2{AuthTokens: []string{"secret"}})
+
+	handler, err := proxy.Handler()
+	require.NoError(t, err)
+	httpServer := httptest.NewServer(handler)
+	defer httpServer.Close()
+
+	t.Run("rejects requests without a token", func(t *testing.T) {
+		resp, err := http.Post(httpServer.URL, "application/json", nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("serves the meta-tools over streamable HTTP", func(t *testing.T) {
+		c, err := mcpclient.NewStreamableHttpClient(httpServer.URL,
+			transport.WithHTTPHeaders(map[string]string{"Authorization": "Bearer secret"}))
+		require.NoError(t, err)
+		defer c.Close()
+		initializeClient(t, ctx, c)
+
+		result := callTool(t, ctx, c, "search_tools", map[string]interface{}{"query": "create issue"})
+		require.False(t, result.IsError)
+		assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "github.create_issue")
+	})
+}
+
+func TestProxyRejectsUnknownHTTPType(t *testing.T) {
+	proxy := newTestProxy(t, config.MCPServerType("carrier-pigeon"), nil)
+	_, err := proxy.Handler()
+	assert.ErrorContains(t, err, "unknown server type")
+}
+
+func TestProxyServesSSEAndStreamableTogether(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeSSE, nil)
+	proxy.cfg.McpProxy.Transports = []config.MCPServerType{config.MCPServerTypeSSE, config.MCPServerTypeStreamable}
+
+	handler, err := proxy.Handler()
+	require.NoError(t, err)
+	httpServer := httptest.NewServer(handler)
+	defer httpServer.Close()
+
+	for name, newClient := range map[string]func() (*mcpclient.Client, error){
+		"streamable-http on /mcp": func() (*mcpclient.Client, error) {
+			return mcpclient.NewStreamableHttpClient(httpServer.URL + "/mcp")
+		},
+		"sse on /sse": func() (*mcpclient.Client, error) {
+			return mcpclient.NewSSEMCPClient(httpServer.URL + "/sse")
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, err := newClient()
+			require.NoError(t, err)
+			defer c.Close()
+			initializeClient(t, ctx, c)
+
+			tools, err := c.ListTools(ctx, mcp.ListToolsRequest{})
+			require.NoError(t, err)
+			assert.NotEmpty(t, tools.Tools)
+		})
+	}
+}
+
+func TestProxyServeStopsWithContext(t *testing.T) {
+	proxy := newTestProxy(t, config.MCPServerTypeStreamable, nil)
+	proxy.cfg.McpProxy.Addr = "127.0.0.1:0"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- proxy.Serve(ctx) }()
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after its context was cancelled")
+	}
+}
+
+func TestProxyRejectsUnknownTransport(t *testing.T) {
+	proxy := newTestProxy(t, config.MCPServerTypeStdio, nil)
+	proxy.cfg.McpProxy.Transports = []config.MCPServerType{config.MCPServerTypeStdio, "carrier-pigeon"}
+	assert.ErrorContains(t, proxy.Serve(context.Background()), "unknown server type")
+}
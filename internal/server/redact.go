@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/redact"
+)
+
+// newRedactor builds the redactor from mcpProxy.options.redact, or returns nil if unset
+func newRedactor(options *config.OptionsV2, servers map[string]*config.MCPClientConfigV2) (*redact.Redactor, error) {
+	if options == nil || options.Redact == nil {
+		return nil, nil
+	}
+	redactor, err := redact.New(options.Redact.Patterns)
+	if err != nil {
+		return nil, err
+	}
+	updateSecrets(redactor, options, servers)
+	return redactor, nil
+}
+
+// updateSecrets captures the env and header values of servers, e.g. after a hierarchy reload
+func updateSecrets(redactor *redact.Redactor, options *config.OptionsV2, servers map[string]*config.MCPClientConfigV2) {
+	if redactor == nil || !options.Redact.ConfigValues.OrElse(true) {
+		return
+	}
+	redactor.SetSecrets(redact.ConfigSecrets(servers, options))
+}
+
+// redactMiddleware scrubs the result and error of every tool call before it is sent to the client
+func redactMiddleware(redactor *redact.Redactor) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := next(ctx, request)
+			if err != nil {
+				if message := redactor.String(err.Error()); message != err.Error() {
+					err = &redactedError{message: message, err: err}
+				}
+			}
+			return redactResult(redactor, result), err
+		}
+	}
+}
+
+// redactedError replaces the message of an error that leaked a secret
+// It still unwraps to the original, so errors.Is and errors.As see e.g. a ToolTimeoutError or
+// hierarchy.ErrAccessDenied through it.
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactResult scrubs the text and embedded text resources of result in place, and its structured content
+func redactResult(redactor *redact.Redactor, result *mcp.CallToolResult) *mcp.CallToolResult {
+	if result == nil {
+		return nil
+	}
+	for i, content := range result.Content {
+		switch c := content.(type) {
+		case mcp.TextContent:
+			c.Text = redactor.String(c.Text)
+			result.Content[i] = c
+		case *mcp.TextContent:
+			c.Text = redactor.String(c.Text)
+		case mcp.EmbeddedResource:
+			c.Resource = redactResourceContents(redactor, c.Resource)
+			result.Content[i] = c
+		case *mcp.EmbeddedResource:
+			c.Resource = redactResourceContents(redactor, c.Resource)
+		}
+	}
+	if result.StructuredContent != nil {
+		result.StructuredContent = redactor.Value(result.StructuredContent)
+	}
+	return result
+}
+
+func redactResourceContents(redactor *redact.Redactor, contents mcp.ResourceContents) mcp.ResourceContents {
+	switch c := contents.(type) {
+	case mcp.TextResourceContents:
+		c.Text = redactor.String(c.Text)
+		return c
+	case *mcp.TextResourceContents:
+		c.Text = redactor.String(c.Text)
+	}
+	return contents
+}
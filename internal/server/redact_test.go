@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/TBXark/optional-go"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/audit"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/hierarchy"
+)
+
+func TestRedactMiddleware(t *testing.T) {
+	options := &config.OptionsV2{Redact: &config.RedactConfig{Patterns: []string{`ghp_\w+`}}}
+	redactor, err := newRedactor(options, map[string]*config.MCPClientConfigV2{
+		"everything": {Env: map[string]string{"API_KEY": "sk-everything-123"}},
+	})
+	require.NoError(t, err)
+
+	handler := redactMiddleware(redactor)(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if request.Params.Name == "fail" {
+			return nil, fmt.Errorf("%w: upstream rejected sk-everything-123", hierarchy.ErrAccessDenied)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.NewTextContent("API_KEY=sk-everything-123"),
+				mcp.NewEmbeddedResource(mcp.TextResourceContents{URI: "env://", Text: "token ghp_abc123"}),
+			},
+			StructuredContent: map[string]interface{}{"env": map[string]interface{}{"API_KEY": "sk-everything-123"}},
+		}, nil
+	})
+
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "printEnv"
+	result, err := handler(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, "API_KEY=[REDACTED]", result.Content[0].(mcp.TextContent).Text)
+	assert.Equal(t, "token [REDACTED]", result.Content[1].(mcp.EmbeddedResource).Resource.(mcp.TextResourceContents).Text)
+	assert.Equal(t, map[string]interface{}{"env": map[string]interface{}{"API_KEY": "[REDACTED]"}}, result.StructuredContent)
+
+	request.Params.Name = "fail"
+	_, err = handler(context.Background(), request)
+	assert.EqualError(t, err, "access denied: upstream rejected [REDACTED]")
+	assert.ErrorIs(t, err, hierarchy.ErrAccessDenied, "redacting keeps the error chain")
+
+	// configValues: false keeps only the patterns
+	options.Redact.ConfigValues = optional.NewField(false)
+	redactor, err = newRedactor(options, map[string]*config.MCPClientConfigV2{
+		"everything": {Env: map[string]string{"API_KEY": "sk-everything-123"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "sk-everything-123 [REDACTED]", redactor.String("sk-everything-123 ghp_abc123"))
+}
+
+func TestProxyRedactsLogsAndAuditRecords(t *testing.T) {
+	var logs bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&logs)
+	defer log.SetOutput(previous)
+
+	ctx := context.Background()
+	logPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	proxy := newTestProxy(t, config.MCPServerTypeStdio, &config.OptionsV2{
+		AuthTokens: []string{"proxy-token-0123"},
+		Redact:     &config.RedactConfig{},
+		Audit:      &config.AuditConfig{Path: logPath, LogArguments: true},
+	})
+
+	log.Printf("client sent proxy-token-0123")
+	assert.Contains(t, logs.String(), "client sent [REDACTED]")
+	assert.NotContains(t, logs.String(), "proxy-token-0123")
+
+	c, err := mcpclient.NewInProcessClient(proxy.MCPServer())
+	require.NoError(t, err)
+	defer c.Close()
+	initializeClient(t, ctx, c)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "execute_tool"
+	request.Params.Arguments = map[string]interface{}{
+		"tool_path": "github.create_issue",
+		"arguments": map[string]interface{}{"title": "leaked proxy-token-0123"},
+	}
+	_, err = c.CallTool(ctx, request)
+	require.Error(t, err)
+
+	records, err := audit.Query(logPath, audit.Filter{}, 0)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "leaked [REDACTED]", records[0].Arguments["title"])
+
+	proxy.Close()
+	log.Printf("after close proxy-token-0123")
+	assert.Contains(t, logs.String(), "after close proxy-token-0123", "Close restores the log output")
+}
@@ -3,18 +3,16 @@ package server
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"os/signal"
 	"strings"
 	"syscall"
-	"time"
 
 	"github.com/voicetreelab/lazy-mcp/internal/config"
 	"github.com/voicetreelab/lazy-mcp/internal/hierarchy"
+	"github.com/voicetreelab/lazy-mcp/internal/redact"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
@@ -46,6 +44,7 @@ func newAuthMiddleware(tokens []string) MiddlewareFunc {
 					http.Error(w, "Unauthorized", http.StatusUnauthorized)
 					return
 				}
+				r = r.WithContext(withCallerToken(r.Context(), token))
 			}
 			next.ServeHTTP(w, r)
 		})
@@ -75,36 +74,9 @@ func recoverMiddleware(prefix string) MiddlewareFunc {
 	}
 }
 
-// StartStdioServer starts the stdio server with the given configuration
-func StartStdioServer(cfg *config.Config) error {
-	// Load hierarchy from filesystem
-	log.Printf("Loading hierarchy from %s", cfg.McpProxy.HierarchyPath)
-	h, err := hierarchy.LoadHierarchy(cfg.McpProxy.HierarchyPath)
-	if err != nil {
-		return fmt.Errorf("failed to load hierarchy: %w", err)
-	}
-
-	// Create server registry for lazy-loaded MCP clients
-	registry := hierarchy.NewServerRegistry(cfg.McpServers)
-	defer registry.Close()
-
-	// Create ONE MCP server with 2 meta-tools
-	serverOpts := []server.ServerOption{
-		server.WithResourceCapabilities(true, true),
-		server.WithRecovery(),
-	}
-
-	if cfg.McpProxy.Options != nil && cfg.McpProxy.Options.LogEnabled.OrElse(false) {
-		serverOpts = append(serverOpts, server.WithLogging())
-	}
-
-	mcpServer := server.NewMCPServer(
-		cfg.McpProxy.Name,
-		cfg.McpProxy.Version,
-		serverOpts...,
-	)
-
-	// Register get_tools_in_category meta-tool
+// addGetToolsInCategory registers the get_tools_in_category meta-tool
+// Its description embeds the root overview, so it is registered again whenever the hierarchy reloads
+func addGetToolsInCategory(mcpServer *server.MCPServer, h *hierarchy.Hierarchy) {
 	// Build description from root overview
 	description := "You have MCP tools hidden within categories. You MUST use get_tools_in_category to learn more about what available tools you have within these categories. Returns children categories, and tools at the specified path. Call initially with an empty string to get root categories."
 
@@ -123,6 +95,10 @@ func StartStdioServer(cfg *config.Config) error {
 					"type":        "string",
 					"description": "Category path using dot notation (e.g., 'coding_tools' or 'coding_tools.serena.search'). Use empty string or '/' for root.",
 				},
+				"include_schema": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Include the input schema, output schema and annotations of each tool. Use this before execute_tool to get argument names right.",
+				},
 			},
 			Required: []string{"path"},
 		},
@@ -130,15 +106,19 @@ func StartStdioServer(cfg *config.Config) error {
 
 	mcpServer.AddTool(getToolsInCategoryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		path := ""
+		opts := hierarchy.CategoryOptions{Policy: hierarchy.AccessPolicyFromContext(ctx)}
 		if request.Params.Arguments != nil {
 			if argsMap, ok := request.Params.Arguments.(map[string]interface{}); ok {
 				if pathVal, ok := argsMap["path"].(string); ok {
 					path = pathVal
 				}
+				if includeSchema, ok := argsMap["include_schema"].(bool); ok {
+					opts.IncludeSchema = includeSchema
+				}
 			}
 		}
 
-		response, err := h.HandleGetToolsInCategory(path)
+		response, err := h.HandleGetToolsInCategoryWithOptions(path, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -154,8 +134,10 @@ func StartStdioServer(cfg *config.Config) error {
 			},
 		}, nil
 	})
+}
 
-	// Register execute_tool meta-tool
+// addExecuteTool registers the execute_tool meta-tool
+func addExecuteTool(mcpServer *server.MCPServer, h *hierarchy.Hierarchy, registry *hierarchy.ServerRegistry) {
 	executeToolTool := mcp.Tool{
 		Name:        "execute_tool",
 		Description: "Execute a tool by its full path. Automatically proxies the request to the appropriate MCP server.",
@@ -197,79 +179,216 @@ func StartStdioServer(cfg *config.Config) error {
 
 		return h.HandleExecuteTool(ctx, registry, toolPath, arguments)
 	})
+}
 
-	// Serve via stdio
-	log.Printf("Starting hierarchical MCP proxy (stdio server)")
-	return server.ServeStdio(mcpServer)
+// watchHierarchy reloads the hierarchy on disk changes when options.watchHierarchy is set
+// After a reload the meta-tools and exposed tools are re-registered, which notifies clients with tools/list_changed
+func watchHierarchy(ctx context.Context, cfg *config.Config, mcpServer *server.MCPServer, h *hierarchy.Hierarchy, registry *hierarchy.ServerRegistry, exposed []string, direct *directTools, promoter *toolPromoter, redactor *redact.Redactor) {
+	if cfg.McpProxy.Options == nil || !cfg.McpProxy.Options.WatchHierarchy.OrElse(false) {
+		return
+	}
+
+	go h.Watch(ctx, cfg.McpProxy.Options.HierarchyWatchInterval.Duration(), func() {
+		serverConfigs := hierarchy.MergeServerConfigs(cfg.McpServers, h.ServerConfigs(), cfg.McpProxy.Options)
+		changed := registry.SetServerConfigs(serverConfigs)
+		updateSecrets(redactor, cfg.McpProxy.Options, serverConfigs)
+		registry.PreloadServers(changed)
+		addGetToolsInCategory(mcpServer, h)
+		exposed = syncExposedTools(mcpServer, h, registry, direct, cfg.McpProxy.Options.PinnedTools, exposed)
+		if promoter != nil {
+			promoter.setStatic(exposed)
+			promoter.dropUnresolved()
+		}
+	})
 }
 
-// StartHTTPServer starts the HTTP server with the given configuration
-func StartHTTPServer(cfg *config.Config) error {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// metaToolNames are the tools the proxy always registers; no exposed or promoted tool may take their name
+var metaToolNames = map[string]bool{
+	"get_tools_in_category": true,
+	"execute_tool":          true,
+	"describe_tool":         true,
+	"search_tools":          true,
+	"list_resources":        true,
+	"read_resource":         true,
+	"list_prompts":          true,
+	"get_prompt":            true,
+}
 
-	// Load hierarchy from filesystem
-	log.Printf("Loading hierarchy from %s", cfg.McpProxy.HierarchyPath)
-	h, err := hierarchy.LoadHierarchy(cfg.McpProxy.HierarchyPath)
-	if err != nil {
-		return fmt.Errorf("failed to load hierarchy: %w", err)
+// syncExposedTools publishes the tools of nodes marked "expose" and the pinnedTools as direct MCP tools
+// Each one is named after its tool path, uses the stored inputSchema and is proxied through execute_tool.
+// Tools in previous that are no longer exposed are removed. Returns the names of the exposed tools.
+func syncExposedTools(mcpServer *server.MCPServer, h *hierarchy.Hierarchy, registry *hierarchy.ServerRegistry, direct *directTools, pinned []string, previous []string) []string {
+	var exposed []hierarchy.ExposedTool
+	for _, exposedTool := range h.ExposedTools(pinned) {
+		// Registering it would replace the meta-tool of the same name
+		if metaToolNames[exposedTool.Name] {
+			log.Printf("Warning: not exposing %s, its name %s is taken by a meta-tool", exposedTool.ToolPath, exposedTool.Name)
+			continue
+		}
+		exposed = append(exposed, exposedTool)
 	}
 
-	// Create server registry for lazy-loaded MCP clients
-	registry := hierarchy.NewServerRegistry(cfg.McpServers)
-	defer registry.Close()
+	current := make(map[string]bool, len(exposed))
+	serverTools := make([]server.ServerTool, 0, len(exposed))
+	for _, exposedTool := range exposed {
+		current[exposedTool.Name] = true
+		direct.record(exposedTool.Name, exposedTool.ToolPath)
+		serverTools = append(serverTools, server.ServerTool{
+			Tool:    exposedMCPTool(exposedTool),
+			Handler: exposedToolHandler(h, registry, exposedTool.ToolPath),
+		})
+	}
 
-	// Create ONE MCP server with 2 meta-tools
-	serverOpts := []server.ServerOption{
-		server.WithResourceCapabilities(true, true),
-		server.WithRecovery(),
+	var stale []string
+	for _, name := range previous {
+		if !current[name] {
+			stale = append(stale, name)
+		}
+	}
+	if len(stale) > 0 {
+		mcpServer.DeleteTools(stale...)
+	}
+	if len(serverTools) > 0 {
+		mcpServer.AddTools(serverTools...)
 	}
 
-	if cfg.McpProxy.Options != nil && cfg.McpProxy.Options.LogEnabled.OrElse(false) {
-		serverOpts = append(serverOpts, server.WithLogging())
+	names := make([]string, 0, len(exposed))
+	for _, exposedTool := range exposed {
+		names = append(names, exposedTool.Name)
+	}
+	if len(names) > 0 {
+		log.Printf("Exposing %d hierarchy tools directly: %s", len(names), strings.Join(names, ", "))
 	}
+	return names
+}
 
-	mcpServer := server.NewMCPServer(
-		cfg.McpProxy.Name,
-		cfg.McpProxy.Version,
-		serverOpts...,
-	)
+// exposedMCPTool builds the MCP tool definition of an exposed hierarchy tool
+func exposedMCPTool(exposedTool hierarchy.ExposedTool) mcp.Tool {
+	toolDef := exposedTool.Tool
+	description := toolDef.Description
+	if description == "" {
+		description = fmt.Sprintf("Runs %s", exposedTool.ToolPath)
+	}
 
-	// Register get_tools_in_category meta-tool
-	// Build description from root overview
-	description := "You have MCP tools hidden within categories. You MUST use get_tools_in_category to learn more about what available tools you have within these categories. Returns children categories, and tools at the specified path. Call initially with an empty string to get root categories."
+	tool := mcp.Tool{
+		Name:        exposedTool.Name,
+		Description: description,
+	}
 
-	// Get root node and use its overview
-	if rootNode := h.GetRootNode(); rootNode != nil && rootNode.Overview != "" {
-		description += fmt.Sprintf("\n\n%s", rootNode.Overview)
+	schema := toolDef.InputSchema
+	if len(schema) == 0 {
+		schema = map[string]interface{}{"type": "object"}
+	}
+	if rawSchema, err := json.Marshal(schema); err == nil {
+		tool.RawInputSchema = rawSchema
 	}
+	if toolDef.OutputSchema != nil {
+		if rawSchema, err := json.Marshal(toolDef.OutputSchema); err == nil {
+			tool.RawOutputSchema = rawSchema
+		}
+	}
+	if toolDef.Annotations != nil {
+		if rawAnnotations, err := json.Marshal(toolDef.Annotations); err == nil {
+			_ = json.Unmarshal(rawAnnotations, &tool.Annotations)
+		}
+	}
+	return tool
+}
 
-	getToolsInCategoryTool := mcp.Tool{
-		Name:        "get_tools_in_category",
-		Description: description,
+// exposedToolHandler proxies a call of an exposed tool exactly like execute_tool would
+func exposedToolHandler(h *hierarchy.Hierarchy, registry *hierarchy.ServerRegistry, toolPath string) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		arguments := request.GetArguments()
+		if arguments == nil {
+			arguments = make(map[string]interface{})
+		}
+		return h.HandleExecuteTool(ctx, registry, toolPath, arguments)
+	}
+}
+
+// addResourceTools registers the list_resources and read_resource meta-tools
+func addResourceTools(mcpServer *server.MCPServer, h *hierarchy.Hierarchy, registry *hierarchy.ServerRegistry) {
+	listResourcesTool := mcp.Tool{
+		Name:        "list_resources",
+		Description: "List MCP resources. Without a server, lists the resources declared in the hierarchy. With a server, starts it if needed and lists its resources and resource templates.",
 		InputSchema: mcp.ToolInputSchema{
 			Type: "object",
 			Properties: map[string]interface{}{
-				"path": map[string]interface{}{
+				"server": map[string]interface{}{
 					"type":        "string",
-					"description": "Category path using dot notation (e.g., 'coding_tools' or 'coding_tools.serena.search'). Use empty string or '/' for root.",
+					"description": "Name of the MCP server to list resources from (optional)",
 				},
 			},
-			Required: []string{"path"},
 		},
 	}
 
-	mcpServer.AddTool(getToolsInCategoryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		path := ""
-		if request.Params.Arguments != nil {
-			if argsMap, ok := request.Params.Arguments.(map[string]interface{}); ok {
-				if pathVal, ok := argsMap["path"].(string); ok {
-					path = pathVal
-				}
-			}
+	mcpServer.AddTool(listResourcesTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		serverName := request.GetString("server", "")
+
+		response, err := h.HandleListResources(ctx, registry, serverName)
+		if err != nil {
+			return nil, err
+		}
+
+		jsonBytes, err := json.MarshalIndent(response, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.NewTextContent(string(jsonBytes)),
+			},
+		}, nil
+	})
+
+	readResourceTool := mcp.Tool{
+		Name:        "read_resource",
+		Description: "Read an MCP resource by URI. The owning server is started on first access. The server can be omitted for resources declared in the hierarchy.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"uri": map[string]interface{}{
+					"type":        "string",
+					"description": "URI of the resource (e.g., 'file:///README.md')",
+				},
+				"server": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the MCP server that owns the resource (optional for resources in the hierarchy)",
+				},
+			},
+			Required: []string{"uri"},
+		},
+	}
+
+	mcpServer.AddTool(readResourceTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		uri := request.GetString("uri", "")
+		if uri == "" {
+			return nil, fmt.Errorf("uri is required")
 		}
 
-		response, err := h.HandleGetToolsInCategory(path)
+		return h.HandleReadResource(ctx, registry, uri, request.GetString("server", ""))
+	})
+}
+
+// addPromptTools registers the list_prompts and get_prompt meta-tools
+func addPromptTools(mcpServer *server.MCPServer, h *hierarchy.Hierarchy, registry *hierarchy.ServerRegistry) {
+	listPromptsTool := mcp.Tool{
+		Name:        "list_prompts",
+		Description: "List MCP prompts. Without a server, lists the prompts declared in the hierarchy with their prompt_path. With a server, starts it if needed and lists its prompts.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"server": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the MCP server to list prompts from (optional)",
+				},
+			},
+		},
+	}
+
+	mcpServer.AddTool(listPromptsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		response, err := h.HandleListPrompts(ctx, registry, request.GetString("server", ""))
 		if err != nil {
 			return nil, err
 		}
@@ -286,39 +405,88 @@ func StartHTTPServer(cfg *config.Config) error {
 		}, nil
 	})
 
-	// Register execute_tool meta-tool
-	executeToolTool := mcp.Tool{
-		Name:        "execute_tool",
-		Description: "Execute a tool by its full path. Automatically proxies the request to the appropriate MCP server.",
+	getPromptTool := mcp.Tool{
+		Name:        "get_prompt",
+		Description: "Get a rendered MCP prompt, either by prompt_path from the hierarchy or by server and prompt name. The owning server is started on first access.",
 		InputSchema: mcp.ToolInputSchema{
 			Type: "object",
 			Properties: map[string]interface{}{
-				"tool_path": map[string]interface{}{
+				"prompt_path": map[string]interface{}{
 					"type":        "string",
-					"description": "Full tool path using dot notation (e.g., 'coding_tools.serena.search.search_symbol') or just tool name if unique",
+					"description": "Full prompt path using dot notation (e.g., 'coding_tools.github.review_pr')",
+				},
+				"server": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the MCP server, when not using prompt_path",
+				},
+				"name": map[string]interface{}{
+					"type":        "string",
+					"description": "Prompt name on the server, when not using prompt_path",
 				},
 				"arguments": map[string]interface{}{
 					"type":                 "object",
-					"description":          "Arguments to pass to the tool",
-					"additionalProperties": true,
+					"description":          "Prompt arguments",
+					"additionalProperties": map[string]interface{}{"type": "string"},
 				},
 			},
-			Required: []string{"tool_path", "arguments"},
 		},
 	}
 
-	mcpServer.AddTool(executeToolTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		toolPath := ""
-		arguments := make(map[string]interface{})
+	mcpServer.AddTool(getPromptTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		arguments := make(map[string]string)
+		if argsMap, ok := request.GetArguments()["arguments"].(map[string]interface{}); ok {
+			for name, value := range argsMap {
+				if s, ok := value.(string); ok {
+					arguments[name] = s
+				} else {
+					arguments[name] = fmt.Sprint(value)
+				}
+			}
+		}
 
+		result, err := h.HandleGetPrompt(ctx, registry,
+			request.GetString("prompt_path", ""), request.GetString("server", ""), request.GetString("name", ""), arguments)
+		if err != nil {
+			return nil, err
+		}
+
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.NewTextContent(string(jsonBytes)),
+			},
+		}, nil
+	})
+}
+
+// addDescribeTool registers the describe_tool meta-tool
+func addDescribeTool(mcpServer *server.MCPServer, h *hierarchy.Hierarchy) {
+	describeTool := mcp.Tool{
+		Name:        "describe_tool",
+		Description: "Get the full contract of a single tool by its path: description, server, input schema, output schema and annotations. Use this before execute_tool when you need the exact argument names.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"tool_path": map[string]interface{}{
+					"type":        "string",
+					"description": "Full tool path using dot notation (e.g., 'coding_tools.serena.search.search_symbol')",
+				},
+			},
+			Required: []string{"tool_path"},
+		},
+	}
+
+	mcpServer.AddTool(describeTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		toolPath := ""
 		if request.Params.Arguments != nil {
 			if argsMap, ok := request.Params.Arguments.(map[string]interface{}); ok {
 				if pathVal, ok := argsMap["tool_path"].(string); ok {
 					toolPath = pathVal
 				}
-				if argsVal, ok := argsMap["arguments"].(map[string]interface{}); ok {
-					arguments = argsVal
-				}
 			}
 		}
 
@@ -326,68 +494,101 @@ func StartHTTPServer(cfg *config.Config) error {
 			return nil, fmt.Errorf("tool_path is required")
 		}
 
-		return h.HandleExecuteTool(ctx, registry, toolPath, arguments)
-	})
+		if err := h.CheckAccess(hierarchy.AccessPolicyFromContext(ctx), toolPath); err != nil {
+			return nil, err
+		}
 
-	// Set up HTTP handler (SSE or Streamable)
-	var handler http.Handler
-	switch cfg.McpProxy.Type {
-	case config.MCPServerTypeSSE:
-		handler = server.NewSSEServer(
-			mcpServer,
-			server.WithStaticBasePath(""),
-			server.WithBaseURL(cfg.McpProxy.BaseURL),
-		)
-	case config.MCPServerTypeStreamable:
-		handler = server.NewStreamableHTTPServer(
-			mcpServer,
-			server.WithStateLess(true),
-		)
-	default:
-		return fmt.Errorf("unknown server type: %s", cfg.McpProxy.Type)
-	}
+		response, err := h.HandleDescribeTool(toolPath)
+		if err != nil {
+			return nil, err
+		}
 
-	// Apply middleware
-	middlewares := make([]MiddlewareFunc, 0)
-	middlewares = append(middlewares, recoverMiddleware("mcp-proxy"))
-	if cfg.McpProxy.Options != nil && cfg.McpProxy.Options.LogEnabled.OrElse(false) {
-		middlewares = append(middlewares, loggerMiddleware("mcp-proxy"))
-	}
-	if cfg.McpProxy.Options != nil && len(cfg.McpProxy.Options.AuthTokens) > 0 {
-		middlewares = append(middlewares, newAuthMiddleware(cfg.McpProxy.Options.AuthTokens))
-	}
-	handler = chainMiddleware(handler, middlewares...)
+		jsonBytes, err := json.MarshalIndent(response, "", "  ")
+		if err != nil {
+			return nil, err
+		}
 
-	// Start HTTP server
-	httpMux := http.NewServeMux()
-	httpMux.Handle("/", handler)
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.NewTextContent(string(jsonBytes)),
+			},
+		}, nil
+	})
+}
 
-	httpServer := &http.Server{
-		Addr:    cfg.McpProxy.Addr,
-		Handler: httpMux,
+// addSearchTools registers the search_tools meta-tool
+func addSearchTools(mcpServer *server.MCPServer, h *hierarchy.Hierarchy) {
+	searchTool := mcp.Tool{
+		Name:        "search_tools",
+		Description: "Search every tool in the hierarchy by keywords (e.g., 'create github issue'). Returns the best matching tool paths with short descriptions, ready for describe_tool or execute_tool. Faster than browsing categories when you know roughly what you need.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "Keywords describing the tool you are looking for",
+				},
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": "Maximum number of results (default 10, max 50)",
+				},
+			},
+			Required: []string{"query"},
+		},
 	}
 
-	go func() {
-		log.Printf("Starting hierarchical MCP proxy (%s server)", cfg.McpProxy.Type)
-		log.Printf("%s server listening on %s", cfg.McpProxy.Type, cfg.McpProxy.Addr)
-		hErr := httpServer.ListenAndServe()
-		if hErr != nil && !errors.Is(hErr, http.ErrServerClosed) {
-			log.Fatalf("Failed to start server: %v", hErr)
+	mcpServer.AddTool(searchTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		query := ""
+		limit := 0
+		if request.Params.Arguments != nil {
+			if argsMap, ok := request.Params.Arguments.(map[string]interface{}); ok {
+				if queryVal, ok := argsMap["query"].(string); ok {
+					query = queryVal
+				}
+				if limitVal, ok := argsMap["limit"].(float64); ok {
+					limit = int(limitVal)
+				}
+			}
 		}
-	}()
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+		if strings.TrimSpace(query) == "" {
+			return nil, fmt.Errorf("query is required")
+		}
 
-	<-sigChan
-	log.Println("Shutdown signal received")
+		response, err := h.HandleSearchToolsWithPolicy(query, limit, hierarchy.AccessPolicyFromContext(ctx))
+		if err != nil {
+			return nil, err
+		}
 
-	shutdownCtx, shutdownCancel := context.WithTimeout(ctx, 5*time.Second)
-	defer shutdownCancel()
+		jsonBytes, err := json.MarshalIndent(response, "", "  ")
+		if err != nil {
+			return nil, err
+		}
 
-	err = httpServer.Shutdown(shutdownCtx)
-	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.NewTextContent(string(jsonBytes)),
+			},
+		}, nil
+	})
+}
+
+// StartServers serves the proxy over mcpProxy.type, or every transport listed in mcpProxy.transports
+// from one process, sharing a single hierarchy and server pool. It runs until SIGINT or SIGTERM is
+// received, or until the stdio client disconnects when stdio is one of the transports.
+func StartServers(cfg *config.Config) error {
+	proxy, err := NewHierarchicalProxy(cfg)
+	if err != nil {
 		return err
 	}
-	return nil
+	defer proxy.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err = proxy.Serve(ctx)
+	if ctx.Err() != nil {
+		log.Println("Shutdown signal received")
+	}
+	return err
 }
@@ -0,0 +1,340 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/hierarchy"
+)
+
+const (
+	// defaultSessionTimeout applies when statefulSessions is set without sessionTimeout
+	defaultSessionTimeout = 30 * time.Minute
+	// maxSessionHistory caps the call history kept per session
+	maxSessionHistory = 100
+	// sessionIDPrefix marks session IDs issued by the proxy
+	sessionIDPrefix = "mcp-session-"
+)
+
+type callerTokenKey struct{}
+
+type sessionKey struct{}
+
+// withCallerToken records the bearer token that authenticated the request
+func withCallerToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, callerTokenKey{}, token)
+}
+
+// callerToken returns the bearer token that authenticated the request, or "" if there is none
+func callerToken(ctx context.Context) string {
+	token, _ := ctx.Value(callerTokenKey{}).(string)
+	return token
+}
+
+// sessionFromContext returns the session of the tool call, or nil outside a tracked session
+func sessionFromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionKey{}).(*Session)
+	return session
+}
+
+// CallRecord is one tool call made in a session
+type CallRecord struct {
+	Tool     string        `json:"tool"`
+	ToolPath string        `json:"tool_path,omitempty"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Session is the proxy-side state of one connected MCP client
+type Session struct {
+	ID      string
+	Created time.Time
+
+	mu sync.Mutex
+	// owner is the hash of the bearer token the session was created with, set once bound is true
+	owner    [sha256.Size]byte
+	bound    bool
+	identity string
+	// connected is set while the session's stdio, SSE or streamable-http listening stream is open
+	connected  bool
+	lastSeen   time.Time
+	categories []string
+	history    []CallRecord
+}
+
+// Identity names the caller by its token label or a fingerprint of its bearer token, so the token
+// itself never appears in logs
+func (s *Session) Identity() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.identity == "" {
+		return tokenIdentity("")
+	}
+	return s.identity
+}
+
+// Categories returns the hierarchy paths browsed in this session, in discovery order
+func (s *Session) Categories() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.categories)
+}
+
+// History returns the most recent tool calls of this session, oldest first
+func (s *Session) History() []CallRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.history)
+}
+
+// LastSeen returns the time of the last request in this session
+func (s *Session) LastSeen() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastSeen
+}
+
+func (s *Session) record(call CallRecord, category string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if category != "" && !slices.Contains(s.categories, category) {
+		s.categories = append(s.categories, category)
+	}
+	s.history = append(s.history, call)
+	if len(s.history) > maxSessionHistory {
+		s.history = slices.Delete(s.history, 0, len(s.history)-maxSessionHistory)
+	}
+}
+
+// tokenIdentity returns a stable, non-reversible name for a bearer token
+func tokenIdentity(token string) string {
+	if token == "" {
+		return "anonymous"
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:4])
+}
+
+// sessionStore tracks client sessions and expires them after a period without requests
+// It is the session ID manager of the stateful streamable-http front-end, and also follows
+// the stdio and SSE sessions, which are stateful by nature.
+type sessionStore struct {
+	timeout time.Duration
+	now     func() time.Time
+	auth    *authorizer
+	// onEnd, if set, is called with the ID of every session that is terminated or expires
+	onEnd func(sessionID string)
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+var _ server.SessionIdManager = (*sessionStore)(nil)
+
+func newSessionStore(options *config.OptionsV2, auth *authorizer) *sessionStore {
+	timeout := defaultSessionTimeout
+	if options != nil && options.SessionTimeout > 0 {
+		timeout = options.SessionTimeout.Duration()
+	}
+	return &sessionStore{
+		timeout:  timeout,
+		now:      time.Now,
+		auth:     auth,
+		sessions: make(map[string]*Session),
+	}
+}
+
+// Generate issues the ID of a new streamable-http session
+func (st *sessionStore) Generate() string {
+	id := sessionIDPrefix + rand.Text()
+	st.get(id)
+	return id
+}
+
+// Validate reports unknown and expired sessions as terminated, so clients initialize a new one
+func (st *sessionStore) Validate(sessionID string) (bool, error) {
+	if !strings.HasPrefix(sessionID, sessionIDPrefix) {
+		return false, fmt.Errorf("invalid session id: %s", sessionID)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	session, ok := st.sessions[sessionID]
+	if !ok || st.expired(session, st.now()) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// Terminate ends a session at the client's request
+func (st *sessionStore) Terminate(sessionID string) (bool, error) {
+	st.remove(sessionID)
+	return false, nil
+}
+
+// get returns the session with the given ID, creating it on first use
+func (st *sessionStore) get(sessionID string) *Session {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	now := st.now()
+	session, ok := st.sessions[sessionID]
+	if !ok {
+		session = &Session{ID: sessionID, Created: now}
+		st.sessions[sessionID] = session
+	}
+	session.mu.Lock()
+	session.lastSeen = now
+	session.mu.Unlock()
+	return session
+}
+
+func (st *sessionStore) remove(sessionID string) {
+	st.mu.Lock()
+	delete(st.sessions, sessionID)
+	st.mu.Unlock()
+
+	if st.onEnd != nil {
+		st.onEnd(sessionID)
+	}
+}
+
+// connect marks the session as held open by its transport until it unregisters
+func (st *sessionStore) connect(sessionID string) {
+	session := st.get(sessionID)
+	session.mu.Lock()
+	session.connected = true
+	session.mu.Unlock()
+}
+
+// expired must be called with st.mu held
+// A session whose transport is still connected never expires; it ends when the transport does.
+func (st *sessionStore) expired(session *Session, now time.Time) bool {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return !session.connected && now.Sub(session.lastSeen) > st.timeout
+}
+
+// expire drops every disconnected session that has gone unused for longer than the session timeout
+func (st *sessionStore) expire() {
+	st.mu.Lock()
+	now := st.now()
+	var expired []string
+	for id, session := range st.sessions {
+		if st.expired(session, now) {
+			expired = append(expired, id)
+			delete(st.sessions, id)
+		}
+	}
+	st.mu.Unlock()
+
+	if len(expired) > 0 {
+		log.Printf("Expired %d idle sessions", len(expired))
+	}
+	if st.onEnd != nil {
+		for _, id := range expired {
+			st.onEnd(id)
+		}
+	}
+}
+
+// run expires idle sessions until ctx is done
+func (st *sessionStore) run(ctx context.Context) {
+	interval := min(st.timeout, time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			st.expire()
+		}
+	}
+}
+
+// claim binds session to the caller's token on its first request, normally initialize
+// A session ID is not a credential: a caller with another valid token that presents it is refused
+// rather than taking the session, its identity and its promoted tools over.
+func (st *sessionStore) claim(ctx context.Context, session *Session) error {
+	owner := sha256.Sum256([]byte(callerToken(ctx)))
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if !session.bound {
+		session.owner = owner
+		session.bound = true
+		if st.auth != nil {
+			session.identity = st.auth.identity(ctx)
+		}
+		return nil
+	}
+	if session.owner != owner {
+		return fmt.Errorf("%w: session %s belongs to another caller", hierarchy.ErrAccessDenied, session.ID)
+	}
+	return nil
+}
+
+// afterInitialize binds a new session to the token it was initialized with
+func (st *sessionStore) afterInitialize(ctx context.Context, id any, request *mcp.InitializeRequest, result *mcp.InitializeResult) {
+	clientSession := server.ClientSessionFromContext(ctx)
+	if clientSession == nil || clientSession.SessionID() == "" {
+		return
+	}
+	if err := st.claim(ctx, st.get(clientSession.SessionID())); err != nil {
+		log.Printf("Session %s: %v", clientSession.SessionID(), err)
+	}
+}
+
+// middleware attaches the caller's session to every tool call and records the call in its history
+// Stateless streamable-http requests carry no session ID and are not tracked.
+func (st *sessionStore) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		clientSession := server.ClientSessionFromContext(ctx)
+		if clientSession == nil || clientSession.SessionID() == "" {
+			return next(ctx, request)
+		}
+
+		session := st.get(clientSession.SessionID())
+		if err := st.claim(ctx, session); err != nil {
+			return nil, err
+		}
+
+		started := st.now()
+		result, err := next(context.WithValue(ctx, sessionKey{}, session), request)
+
+		call := CallRecord{
+			Tool:     request.Params.Name,
+			ToolPath: request.GetString("tool_path", ""),
+			Started:  started,
+			Duration: st.now().Sub(started),
+		}
+		var category string
+		switch {
+		case err != nil:
+			call.Error = err.Error()
+		case result != nil && result.IsError:
+			call.Error = "tool returned an error"
+		case request.Params.Name == "get_tools_in_category":
+			category = request.GetString("path", "")
+			if category == "" {
+				category = "/"
+			}
+		}
+		session.record(call, category)
+		return result, err
+	}
+}
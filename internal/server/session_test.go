@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TBXark/optional-go"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+)
+
+func newStreamableTestClient(t *testing.T, proxy *Proxy, token string) *mcpclient.Client {
+	t.Helper()
+	handler, err := proxy.Handler()
+	require.NoError(t, err)
+	httpServer := httptest.NewServer(handler)
+	t.Cleanup(httpServer.Close)
+
+	c, err := mcpclient.NewStreamableHttpClient(httpServer.URL,
+		transport.WithHTTPHeaders(map[string]string{"Authorization": "Bearer " + token}))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestStatefulSessions(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStreamable, &config.OptionsV2{
+		AuthTokens:       []string{"secret"},
+		StatefulSessions: optional.NewField(true),
+		SessionTimeout:   config.Duration(time.Minute),
+	})
+	now := time.Now()
+	proxy.sessions.now = func() time.Time { return now }
+
+	c := newStreamableTestClient(t, proxy, "secret")
+	initializeClient(t, ctx, c)
+	sessionID := c.GetSessionId()
+	require.NotEmpty(t, sessionID)
+
+	callTool(t, ctx, c, "get_tools_in_category", map[string]interface{}{"path": "github"})
+	callTool(t, ctx, c, "search_tools", map[string]interface{}{"query": "issue"})
+
+	session := proxy.sessions.sessions[sessionID]
+	require.NotNil(t, session)
+	assert.Equal(t, tokenIdentity("secret"), session.Identity())
+	assert.NotContains(t, session.Identity(), "secret")
+	assert.Equal(t, []string{"github"}, session.Categories())
+
+	history := session.History()
+	require.Len(t, history, 2)
+	assert.Equal(t, "get_tools_in_category", history[0].Tool)
+	assert.Equal(t, "search_tools", history[1].Tool)
+
+	t.Run("expires after the session timeout", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+		proxy.sessions.expire()
+		assert.Empty(t, proxy.sessions.sessions)
+
+		request := mcp.CallToolRequest{}
+		request.Params.Name = "search_tools"
+		request.Params.Arguments = map[string]interface{}{"query": "issue"}
+		_, err := c.CallTool(ctx, request)
+		assert.Error(t, err, "an expired session must be initialized again")
+	})
+}
+
+func TestSessionIsBoundToItsToken(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStreamable, &config.OptionsV2{
+		AuthTokens:       []string{"owner-token", "other-token"},
+		TokenLabels:      map[string]string{"owner-token": "owner", "other-token": "other"},
+		StatefulSessions: optional.NewField(true),
+	})
+
+	owner := newStreamableTestClient(t, proxy, "owner-token")
+	initializeClient(t, ctx, owner)
+	sessionID := owner.GetSessionId()
+	require.NotEmpty(t, sessionID)
+
+	// Another valid token presenting the same Mcp-Session-Id
+	handler, err := proxy.Handler()
+	require.NoError(t, err)
+	httpServer := httptest.NewServer(handler)
+	defer httpServer.Close()
+	trans, err := transport.NewStreamableHTTP(httpServer.URL,
+		transport.WithHTTPHeaders(map[string]string{"Authorization": "Bearer other-token"}),
+		transport.WithSession(sessionID))
+	require.NoError(t, err)
+	other := mcpclient.NewClient(trans, mcpclient.WithSession())
+	require.NoError(t, other.Start(ctx))
+	defer other.Close()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "search_tools"
+	request.Params.Arguments = map[string]interface{}{"query": "issue"}
+	_, err = other.CallTool(ctx, request)
+	assert.ErrorContains(t, err, "belongs to another caller")
+
+	callTool(t, ctx, owner, "search_tools", map[string]interface{}{"query": "issue"})
+	session := proxy.sessions.sessions[sessionID]
+	require.NotNil(t, session)
+	assert.Equal(t, "owner", session.Identity(), "the session keeps the identity it was created with")
+	assert.Len(t, session.History(), 1, "the refused call is not recorded")
+}
+
+func TestConnectedSessionsDoNotExpire(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeSSE, &config.OptionsV2{
+		AuthTokens:     []string{"owner-token", "other-token"},
+		SessionTimeout: config.Duration(time.Minute),
+	})
+	now := time.Now()
+	proxy.sessions.now = func() time.Time { return now }
+
+	handler, err := proxy.Handler()
+	require.NoError(t, err)
+	httpServer := httptest.NewServer(handler)
+	defer httpServer.Close()
+	c, err := mcpclient.NewSSEMCPClient(httpServer.URL+"/sse",
+		transport.WithHeaders(map[string]string{"Authorization": "Bearer owner-token"}))
+	require.NoError(t, err)
+	defer c.Close()
+	initializeClient(t, ctx, c)
+	callTool(t, ctx, c, "search_tools", map[string]interface{}{"query": "issue"})
+
+	require.Len(t, proxy.sessions.sessions, 1)
+	var session *Session
+	for _, s := range proxy.sessions.sessions {
+		session = s
+	}
+
+	// Idle for longer than the session timeout, but the event stream is still open
+	now = now.Add(2 * time.Minute)
+	proxy.sessions.expire()
+	assert.Same(t, session, proxy.sessions.sessions[session.ID])
+
+	other := withCallerToken(ctx, "other-token")
+	assert.ErrorContains(t, proxy.sessions.claim(other, proxy.sessions.get(session.ID)), "belongs to another caller")
+	assert.NoError(t, proxy.sessions.claim(withCallerToken(ctx, "owner-token"), session))
+	callTool(t, ctx, c, "search_tools", map[string]interface{}{"query": "issue"})
+	assert.Len(t, session.History(), 2)
+}
+
+func TestStatelessSessionsAreNotTracked(t *testing.T) {
+	ctx := context.Background()
+	proxy := newTestProxy(t, config.MCPServerTypeStreamable, &config.OptionsV2{AuthTokens: []string{"secret"}})
+
+	c := newStreamableTestClient(t, proxy, "secret")
+	initializeClient(t, ctx, c)
+	assert.Empty(t, c.GetSessionId())
+
+	callTool(t, ctx, c, "search_tools", map[string]interface{}{"query": "issue"})
+	assert.Empty(t, proxy.sessions.sessions)
+}
+
+func TestSessionStoreValidate(t *testing.T) {
+	store := newSessionStore(nil, nil)
+	assert.Equal(t, defaultSessionTimeout, store.timeout)
+
+	id := store.Generate()
+	terminated, err := store.Validate(id)
+	require.NoError(t, err)
+	assert.False(t, terminated)
+
+	_, err = store.Validate("not-a-session")
+	assert.Error(t, err)
+
+	_, err = store.Terminate(id)
+	require.NoError(t, err)
+	terminated, err = store.Validate(id)
+	require.NoError(t, err)
+	assert.True(t, terminated, "terminated sessions are reported so the client starts a new one")
+}
+
+func TestSessionHistoryIsCapped(t *testing.T) {
+	session := &Session{ID: "stdio"}
+	for i := 0; i < maxSessionHistory+10; i++ {
+		session.record(CallRecord{Tool: "search_tools", Duration: time.Duration(i)}, "")
+	}
+
+	history := session.History()
+	require.Len(t, history, maxSessionHistory)
+	assert.Equal(t, time.Duration(10), history[0].Duration, "oldest calls are dropped first")
+	assert.Equal(t, "anonymous", session.Identity())
+}
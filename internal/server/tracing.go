@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/redact"
+	"github.com/voicetreelab/lazy-mcp/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTracer creates the tracer provider from mcpProxy.options.tracing, or returns nil if unset
+func newTracer(options *config.OptionsV2, redactor *redact.Redactor) (*sdktrace.TracerProvider, error) {
+	if options == nil || options.Tracing == nil {
+		return nil, nil
+	}
+	return tracing.New(options.Tracing, redactor)
+}
+
+// tracingMiddleware records a server span for every tool call, continuing the trace of the client
+// from the traceparent in _meta or in the HTTP request headers
+func tracingMiddleware(provider trace.TracerProvider) server.ToolHandlerMiddleware {
+	tracer := provider.Tracer(tracing.ScopeName)
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if meta := request.Params.Meta; meta != nil {
+				if traceparent, ok := meta.AdditionalFields[tracing.TraceparentHeader].(string); ok {
+					ctx = tracing.WithRemoteParent(ctx, traceparent)
+				}
+			}
+
+			ctx, span := tracer.Start(ctx, request.Params.Name, trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(attribute.String("mcp.tool", request.Params.Name)))
+			defer span.End()
+			if toolPath := request.GetString("tool_path", ""); toolPath != "" {
+				span.SetAttributes(attribute.String("mcp.tool_path", toolPath))
+			}
+			if path := request.GetString("path", ""); request.Params.Name == "get_tools_in_category" {
+				span.SetAttributes(attribute.String("mcp.category", path))
+			}
+			if clientSession := server.ClientSessionFromContext(ctx); clientSession != nil && clientSession.SessionID() != "" {
+				span.SetAttributes(attribute.String("mcp.session", clientSession.SessionID()))
+			}
+
+			result, err := next(ctx, request)
+			tracing.RecordError(span, err)
+			if err == nil && result != nil && result.IsError {
+				tracing.RecordError(span, errors.New("tool returned an error"))
+			}
+			return result, err
+		}
+	}
+}
+
+// traceContextMiddleware picks up the traceparent header of incoming HTTP requests
+func traceContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if traceparent := r.Header.Get(tracing.TraceparentHeader); traceparent != "" {
+			r = r.WithContext(tracing.WithRemoteParent(r.Context(), traceparent))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/tracing"
+)
+
+// exportedSpan is the part of a span written by the stdout exporter of a tracing file that the test looks at
+type exportedSpan struct {
+	SpanContext struct{ TraceID, SpanID string }
+	Parent      struct{ SpanID string }
+	Status      struct{ Code string }
+}
+
+// exportedSpans decodes a tracing file into spans keyed by name
+func exportedSpans(t *testing.T, path string) map[string]exportedSpan {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	spans := make(map[string]exportedSpan)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var span struct {
+			Name string
+			exportedSpan
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &span))
+		spans[span.Name] = span.exportedSpan
+	}
+	return spans
+}
+
+func TestProxyTracesToolCalls(t *testing.T) {
+	const (
+		httpTrace = "00-11111111111111111111111111111111-2222222222222222-01"
+		metaTrace = "00-33333333333333333333333333333333-4444444444444444-01"
+	)
+	ctx := context.Background()
+	spansPath := filepath.Join(t.TempDir(), "spans.jsonl")
+	proxy := newTestProxy(t, config.MCPServerTypeStreamable, &config.OptionsV2{
+		Tracing: &config.TracingConfig{File: spansPath},
+	})
+
+	// Streamable HTTP clients pass the trace context as a header
+	handler, err := proxy.Handler()
+	require.NoError(t, err)
+	httpServer := httptest.NewServer(handler)
+	defer httpServer.Close()
+	httpClient, err := mcpclient.NewStreamableHttpClient(httpServer.URL,
+		transport.WithHTTPHeaders(map[string]string{tracing.TraceparentHeader: httpTrace}))
+	require.NoError(t, err)
+	defer httpClient.Close()
+	initializeClient(t, ctx, httpClient)
+	callTool(t, ctx, httpClient, "get_tools_in_category", map[string]interface{}{"path": "github"})
+
+	// Any client can pass it in _meta
+	inProcess, err := mcpclient.NewInProcessClient(proxy.MCPServer())
+	require.NoError(t, err)
+	defer inProcess.Close()
+	initializeClient(t, ctx, inProcess)
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "execute_tool"
+	request.Params.Arguments = map[string]interface{}{"tool_path": "github.create_issue", "arguments": map[string]interface{}{"title": "Bug"}}
+	request.Params.Meta = &mcp.Meta{AdditionalFields: map[string]any{tracing.TraceparentHeader: metaTrace}}
+	_, err = inProcess.CallTool(ctx, request)
+	require.Error(t, err)
+
+	proxy.Close() // Exports the remaining spans
+	spans := exportedSpans(t, spansPath)
+
+	category, ok := spans["get_tools_in_category"]
+	require.True(t, ok)
+	assert.Equal(t, "11111111111111111111111111111111", category.SpanContext.TraceID)
+	assert.Equal(t, "2222222222222222", category.Parent.SpanID)
+
+	execute, ok := spans["execute_tool"]
+	require.True(t, ok)
+	assert.Equal(t, "33333333333333333333333333333333", execute.SpanContext.TraceID)
+	assert.Equal(t, "4444444444444444", execute.Parent.SpanID)
+	assert.Equal(t, "Error", execute.Status.Code, "failed calls are marked as errors")
+
+	load, ok := spans["ServerRegistry.GetOrLoadServer"]
+	require.True(t, ok, "github-mcp does not exist, but its start is traced")
+	assert.Equal(t, execute.SpanContext.SpanID, load.Parent.SpanID)
+}
@@ -0,0 +1,131 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/redact"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	defaultServiceName   = "lazy-mcp"
+	defaultFlushInterval = 5 * time.Second
+)
+
+// New creates a tracer provider from mcpProxy.options.tracing that batches finished spans and
+// exports them to an OTLP/HTTP collector or a file. If redactor is not nil, it scrubs string
+// attributes and error messages before export. Shutdown exports the remaining spans.
+func New(cfg *config.TracingConfig, redactor *redact.Redactor) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	switch {
+	case cfg.Endpoint != "" && cfg.File != "":
+		return nil, errors.New("tracing: configure either endpoint or file, not both")
+	case cfg.Endpoint != "":
+		otlp, err := otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpointURL(tracesURL(cfg.Endpoint)),
+			otlptracehttp.WithHeaders(cfg.Headers))
+		if err != nil {
+			return nil, fmt.Errorf("tracing: %w", err)
+		}
+		exporter = otlp
+	case cfg.File != "":
+		file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("tracing: %w", err)
+		}
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("tracing: %w", err)
+		}
+		exporter = &fileExporter{SpanExporter: stdout, file: file}
+	default:
+		return nil, errors.New("tracing: endpoint or file is required")
+	}
+	if redactor != nil {
+		exporter = &redactingExporter{SpanExporter: exporter, redactor: redactor}
+	}
+
+	service := cfg.ServiceName
+	if service == "" {
+		service = defaultServiceName
+	}
+	interval := cfg.FlushInterval.Duration()
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(interval)),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	), nil
+}
+
+// tracesURL appends the OTLP traces path to a collector endpoint that does not name it already
+func tracesURL(endpoint string) string {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return url
+}
+
+// fileExporter writes one JSON object per span and closes the file on shutdown
+type fileExporter struct {
+	sdktrace.SpanExporter
+	file *os.File
+}
+
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	err := e.SpanExporter.Shutdown(ctx)
+	if closeErr := e.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// redactingExporter scrubs string attributes and the status message of spans before export
+type redactingExporter struct {
+	sdktrace.SpanExporter
+	redactor *redact.Redactor
+}
+
+func (e *redactingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	redacted := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, span := range spans {
+		redacted[i] = redactedSpan{ReadOnlySpan: span, redactor: e.redactor}
+	}
+	return e.SpanExporter.ExportSpans(ctx, redacted)
+}
+
+type redactedSpan struct {
+	sdktrace.ReadOnlySpan
+	redactor *redact.Redactor
+}
+
+func (s redactedSpan) Attributes() []attribute.KeyValue {
+	attributes := s.ReadOnlySpan.Attributes()
+	redacted := make([]attribute.KeyValue, len(attributes))
+	for i, attr := range attributes {
+		if attr.Value.Type() == attribute.STRING {
+			attr = attr.Key.String(s.redactor.String(attr.Value.AsString()))
+		}
+		redacted[i] = attr
+	}
+	return redacted
+}
+
+func (s redactedSpan) Status() sdktrace.Status {
+	status := s.ReadOnlySpan.Status()
+	status.Description = s.redactor.String(status.Description)
+	return status
+}
@@ -0,0 +1,68 @@
+// Package tracing records spans of tool calls with the OpenTelemetry SDK and propagates W3C trace
+// context to downstream servers
+//
+// Spans below a tool call are started with the tracer provider of the current span in the context,
+// so the hierarchy and the server registry need no tracer of their own and record nothing when
+// tracing is disabled.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceparentHeader is the W3C trace context header, also used as the key in MCP _meta
+const TraceparentHeader = "traceparent"
+
+// ScopeName is the instrumentation scope of the proxy's spans
+const ScopeName = "github.com/voicetreelab/lazy-mcp"
+
+var propagator = propagation.TraceContext{}
+
+// Start begins a span as a child of the current span of ctx, using the tracer provider of that span
+// Without a recording span in ctx it returns a no-op span, so callers need not check whether
+// tracing is enabled.
+func Start(ctx context.Context, name string, kind trace.SpanKind, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(ScopeName)
+	return tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attributes...))
+}
+
+// RecordError marks the span as failed with the message of err; a nil err is ignored
+// Unlike span.RecordError it adds no exception event, so the message is only exported as the
+// span status, which the exporter redacts.
+func RecordError(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// WithRemoteParent makes the span described by traceparent, e.g. from an incoming request,
+// the parent of the next span started from ctx. Malformed values are ignored.
+func WithRemoteParent(ctx context.Context, traceparent string) context.Context {
+	return propagator.Extract(ctx, propagation.MapCarrier{TraceparentHeader: traceparent})
+}
+
+// Link returns ctx carrying the current span of from, so work that runs on another context
+// (e.g. a shared server startup) is traced as part of the request in from
+func Link(ctx, from context.Context) context.Context {
+	return trace.ContextWithSpan(ctx, trace.SpanFromContext(from))
+}
+
+// Traceparent returns the traceparent of the current span of ctx, or "" if there is none
+func Traceparent(ctx context.Context) string {
+	return HTTPHeaders(ctx)[TraceparentHeader]
+}
+
+// HTTPHeaders returns the trace context headers for an outgoing request made under ctx
+func HTTPHeaders(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
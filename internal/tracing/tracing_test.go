@@ -0,0 +1,160 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/voicetreelab/lazy-mcp/internal/config"
+	"github.com/voicetreelab/lazy-mcp/internal/redact"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const remoteTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestStartWithoutTracer(t *testing.T) {
+	ctx, span := Start(context.Background(), "noop", trace.SpanKindInternal)
+	assert.False(t, span.IsRecording())
+	span.SetAttributes(attribute.String("k", "v"))
+	RecordError(span, errors.New("ignored"))
+	span.End()
+	assert.Empty(t, Traceparent(ctx))
+	assert.Nil(t, HTTPHeaders(ctx))
+}
+
+func TestRemoteParent(t *testing.T) {
+	ctx := WithRemoteParent(context.Background(), remoteTraceparent)
+	assert.Equal(t, remoteTraceparent, Traceparent(ctx), "an untraced proxy passes the trace context on")
+
+	_, span := Start(ctx, "noop", trace.SpanKindInternal)
+	assert.False(t, span.IsRecording(), "a remote parent alone does not enable tracing")
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		assert.Empty(t, Traceparent(WithRemoteParent(context.Background(), invalid)), invalid)
+	}
+}
+
+// exportedSpan is the part of a span written by the stdout exporter that the tests look at
+type exportedSpan struct {
+	Name        string
+	SpanKind    int
+	SpanContext struct{ TraceID, SpanID string }
+	Parent      struct{ TraceID, SpanID string }
+	Attributes  []struct {
+		Key   string
+		Value struct{ Value interface{} }
+	}
+	Status   struct{ Code, Description string }
+	Resource []struct {
+		Key   string
+		Value struct{ Value interface{} }
+	}
+}
+
+func (s exportedSpan) attribute(key string) interface{} {
+	for _, attr := range s.Attributes {
+		if attr.Key == key {
+			return attr.Value.Value
+		}
+	}
+	return nil
+}
+
+func TestSpansExportToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	redactor, err := redact.New([]string{`secret-\w+`})
+	require.NoError(t, err)
+	provider, err := New(&config.TracingConfig{File: path, ServiceName: "proxy-test"}, redactor)
+	require.NoError(t, err)
+	tracer := provider.Tracer(ScopeName)
+
+	ctx, root := tracer.Start(WithRemoteParent(context.Background(), remoteTraceparent), "execute_tool",
+		trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attribute.String("mcp.tool", "execute_tool")))
+	childCtx, child := Start(ctx, "CallTool echo", trace.SpanKindClient, attribute.Int("attempt", 1), attribute.String("token", "secret-abc"))
+	RecordError(child, errors.New("failed with secret-abc"))
+	sc := child.SpanContext()
+	assert.Equal(t, "00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-01", HTTPHeaders(childCtx)[TraceparentHeader])
+	child.End()
+	root.End()
+
+	// Spans of an unsampled remote parent are not exported
+	unsampled := WithRemoteParent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, dropped := tracer.Start(unsampled, "dropped")
+	dropped.End()
+
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var spans []exportedSpan
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var span exportedSpan
+		require.NoError(t, json.Unmarshal([]byte(line), &span))
+		spans = append(spans, span)
+	}
+	require.Len(t, spans, 2)
+
+	callTool, execute := spans[0], spans[1]
+	assert.Equal(t, "service.name", execute.Resource[0].Key)
+	assert.Equal(t, "proxy-test", execute.Resource[0].Value.Value)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", execute.SpanContext.TraceID, "the remote trace is continued")
+	assert.Equal(t, "00f067aa0ba902b7", execute.Parent.SpanID)
+	assert.Equal(t, int(trace.SpanKindServer), execute.SpanKind)
+	assert.Equal(t, execute.SpanContext.TraceID, callTool.SpanContext.TraceID)
+	assert.Equal(t, execute.SpanContext.SpanID, callTool.Parent.SpanID)
+	assert.Equal(t, "CallTool echo", callTool.Name)
+	assert.Equal(t, float64(1), callTool.attribute("attempt"))
+	assert.Equal(t, "[REDACTED]", callTool.attribute("token"))
+	assert.Equal(t, "Error", callTool.Status.Code)
+	assert.Equal(t, "failed with [REDACTED]", callTool.Status.Description)
+}
+
+func TestSpansExportToCollector(t *testing.T) {
+	received := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "collector-key", r.Header.Get("X-Api-Key"))
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer collector.Close()
+
+	provider, err := New(&config.TracingConfig{Endpoint: collector.URL, Headers: map[string]string{"X-Api-Key": "collector-key"}}, nil)
+	require.NoError(t, err)
+
+	_, span := provider.Tracer(ScopeName).Start(context.Background(), "get_tools_in_category")
+	span.End()
+	require.NoError(t, provider.ForceFlush(context.Background()))
+
+	var request coltracepb.ExportTraceServiceRequest
+	require.NoError(t, proto.Unmarshal(<-received, &request))
+	require.Len(t, request.ResourceSpans, 1)
+	resource := request.ResourceSpans[0].Resource.Attributes[0]
+	assert.Equal(t, "lazy-mcp", resource.Value.GetStringValue())
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 1)
+	assert.Empty(t, spans[0].ParentSpanId, "a span without parent starts a new trace")
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	_, err = New(&config.TracingConfig{Endpoint: collector.URL, File: "spans.jsonl"}, nil)
+	assert.ErrorContains(t, err, "either endpoint or file")
+	_, err = New(&config.TracingConfig{}, nil)
+	assert.ErrorContains(t, err, "endpoint or file is required")
+}
@@ -211,7 +211,8 @@ func fetchToolsFromServer(ctx context.Context, name string, config ServerConfig)
 	}
 	initRequest.Params.Capabilities = mcp.ClientCapabilities{}
 
-	if _, err := mcpClient.Initialize(localCtx, initRequest); err != nil {
+	initResult, err := mcpClient.Initialize(localCtx, initRequest)
+	if err != nil {
 		return generator.ServerTools{}, fmt.Errorf("failed to initialize: %w", err)
 	}
 
@@ -237,10 +238,49 @@ func fetchToolsFromServer(ctx context.Context, name string, config ServerConfig)
 		allTools = append(allTools, tool)
 	}
 
-	return generator.ServerTools{
+	serverTools := generator.ServerTools{
 		ServerName: name,
 		Tools:      allTools,
-	}, nil
+	}
+
+	// Prompts and resources are optional, a server that fails to list them still gets its tools
+	if initResult.Capabilities.Prompts != nil {
+		log.Printf("[%s] Listing prompts...", name)
+		promptsResult, err := mcpClient.ListPrompts(localCtx, mcp.ListPromptsRequest{})
+		if err != nil {
+			log.Printf("[%s] ⚠ Warning: Failed to list prompts: %v", name, err)
+		} else {
+			for _, mcpPrompt := range promptsResult.Prompts {
+				prompt := generator.Prompt{Name: mcpPrompt.Name, Description: mcpPrompt.Description}
+				for _, argument := range mcpPrompt.Arguments {
+					prompt.Arguments = append(prompt.Arguments, generator.PromptArgument{
+						Name:        argument.Name,
+						Description: argument.Description,
+						Required:    argument.Required,
+					})
+				}
+				serverTools.Prompts = append(serverTools.Prompts, prompt)
+			}
+		}
+	}
+	if initResult.Capabilities.Resources != nil {
+		log.Printf("[%s] Listing resources...", name)
+		resourcesResult, err := mcpClient.ListResources(localCtx, mcp.ListResourcesRequest{})
+		if err != nil {
+			log.Printf("[%s] ⚠ Warning: Failed to list resources: %v", name, err)
+		} else {
+			for _, mcpResource := range resourcesResult.Resources {
+				serverTools.Resources = append(serverTools.Resources, generator.Resource{
+					URI:         mcpResource.URI,
+					Name:        mcpResource.Name,
+					Description: mcpResource.Description,
+					MIMEType:    mcpResource.MIMEType,
+				})
+			}
+		}
+	}
+
+	return serverTools, nil
 }
 
 // convertToolInputSchema converts mcp.ToolInputSchema to map[string]interface{}
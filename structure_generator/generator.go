@@ -252,12 +252,19 @@ func RegenerateDirectory(dirPath string, nodeName string) error {
 		finalOverview = generatedOverview
 	}
 
-	// Create the branch node
+	// Create the branch node, keeping the prompts and resources declared on it
 	node := ToolNode{
 		Path:     nodeName,
 		Overview: finalOverview,
 		Tools:    nil, // Branch nodes don't have tools
 	}
+	if existingData != nil {
+		var existingNode ToolNode
+		if json.Unmarshal(existingData, &existingNode) == nil {
+			node.Prompts = existingNode.Prompts
+			node.Resources = existingNode.Resources
+		}
+	}
 
 	// Write the updated JSON file
 	return writeNodeToJSON(node, nodeJSONPath)
@@ -410,10 +417,13 @@ func generateServerStructure(server ServerTools, outputDir string) error {
 	}
 
 	// Create server-level ToolNode (branch node)
+	// Prompts and resources are declared on the server node, so they inherit its server
 	serverNode := ToolNode{
-		Path:     server.ServerName,
-		Overview: overview,
-		Tools:    nil, // Branch node - no direct tools
+		Path:      server.ServerName,
+		Overview:  overview,
+		Tools:     nil, // Branch node - no direct tools
+		Prompts:   promptDefinitions(server),
+		Resources: resourceDefinitions(server),
 	}
 
 	// Write server JSON file: structure/server_name/server_name.json
@@ -421,6 +431,45 @@ func generateServerStructure(server ServerTools, outputDir string) error {
 	return writeNodeToJSON(serverNode, jsonPath)
 }
 
+// promptDefinitions converts the prompts of a server to node entries keyed by prompt name
+func promptDefinitions(server ServerTools) map[string]PromptDefinition {
+	if len(server.Prompts) == 0 {
+		return nil
+	}
+	prompts := make(map[string]PromptDefinition, len(server.Prompts))
+	for _, prompt := range server.Prompts {
+		prompts[prompt.Name] = PromptDefinition{
+			Description: prompt.Description,
+			MapsTo:      prompt.Name, // Maps to the actual MCP prompt name
+			Server:      server.ServerName,
+			Arguments:   prompt.Arguments,
+		}
+	}
+	return prompts
+}
+
+// resourceDefinitions converts the resources of a server to node entries keyed by resource name
+// Resources without a name are keyed by their URI.
+func resourceDefinitions(server ServerTools) map[string]ResourceDefinition {
+	if len(server.Resources) == 0 {
+		return nil
+	}
+	resources := make(map[string]ResourceDefinition, len(server.Resources))
+	for _, resource := range server.Resources {
+		name := resource.Name
+		if name == "" {
+			name = resource.URI
+		}
+		resources[name] = ResourceDefinition{
+			Description: resource.Description,
+			URI:         resource.URI,
+			MIMEType:    resource.MIMEType,
+			Server:      server.ServerName,
+		}
+	}
+	return resources
+}
+
 // generateToolFile creates a JSON file for a single tool in flat structure
 // Structure: parent_dir/tool_name.json
 // This creates a leaf node (has tools, no overview)
@@ -13,10 +13,36 @@ type Tool struct {
 	Annotations map[string]interface{} `json:"annotations,omitempty"`  // Optional: metadata for clients
 }
 
-// ServerTools represents all tools from a single MCP server
+// Prompt represents an MCP prompt definition
+// https://modelcontextprotocol.io/specification/2025-06-18/server/prompts
+type Prompt struct {
+	Name        string           `json:"name"`                  // Required: unique identifier
+	Description string           `json:"description,omitempty"` // Optional: what the prompt is for
+	Arguments   []PromptArgument `json:"arguments,omitempty"`   // Optional: arguments the prompt accepts
+}
+
+// PromptArgument is one argument of a prompt
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Resource represents an MCP resource definition
+// https://modelcontextprotocol.io/specification/2025-06-18/server/resources
+type Resource struct {
+	URI         string `json:"uri"`                   // Required: unique identifier
+	Name        string `json:"name"`                  // Required: name of the resource
+	Description string `json:"description,omitempty"` // Optional: what the resource contains
+	MIMEType    string `json:"mimeType,omitempty"`    // Optional: MIME type of the contents
+}
+
+// ServerTools represents all tools, prompts and resources from a single MCP server
 type ServerTools struct {
-	ServerName string `json:"serverName"`
-	Tools      []Tool `json:"tools"`
+	ServerName string     `json:"serverName"`
+	Tools      []Tool     `json:"tools"`
+	Prompts    []Prompt   `json:"prompts,omitempty"`
+	Resources  []Resource `json:"resources,omitempty"`
 }
 
 // ToolNode represents a node in the hierarchical tool structure
@@ -32,6 +58,11 @@ type ToolNode struct {
 	// Tools maps tool names to their full definitions
 	// Only present for leaf nodes
 	Tools map[string]ToolDefinition `json:"tools,omitempty"`
+
+	// Prompts and Resources map names to the prompts and resources of the server
+	// Only present on server nodes
+	Prompts   map[string]PromptDefinition   `json:"prompts,omitempty"`
+	Resources map[string]ResourceDefinition `json:"resources,omitempty"`
 }
 
 // ToolDefinition is the detailed definition of a single tool for output
@@ -45,6 +76,22 @@ type ToolDefinition struct {
 	Annotations  map[string]interface{} `json:"annotations,omitempty"`
 }
 
+// PromptDefinition is the definition of a single prompt for output
+type PromptDefinition struct {
+	Description string           `json:"description,omitempty"`
+	MapsTo      string           `json:"maps_to,omitempty"` // Maps to actual MCP prompt name
+	Server      string           `json:"server"`            // The MCP server that provides this prompt
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+// ResourceDefinition is the definition of a single resource for output
+type ResourceDefinition struct {
+	Description string `json:"description,omitempty"`
+	URI         string `json:"uri"`
+	MIMEType    string `json:"mimeType,omitempty"`
+	Server      string `json:"server"` // The MCP server that provides this resource
+}
+
 // DomainCategory represents a top-level categorization
 type DomainCategory string
 
@@ -143,6 +190,14 @@ func (n *ToolNode) MarshalJSON() ([]byte, error) {
 		output["tools"] = n.Tools
 	}
 
+	// Only include prompts and resources if present (server nodes)
+	if len(n.Prompts) > 0 {
+		output["prompts"] = n.Prompts
+	}
+	if len(n.Resources) > 0 {
+		output["resources"] = n.Resources
+	}
+
 	// Return un-indented JSON - let the encoder handle indentation
 	return json.Marshal(output)
 }